@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/control"
+	"github.com/Qwental/port-scanner-alert-system/internal/health"
+	"github.com/Qwental/port-scanner-alert-system/internal/heartbeat"
+	"github.com/Qwental/port-scanner-alert-system/internal/maintenance"
+	"github.com/Qwental/port-scanner-alert-system/internal/notifier"
+	"github.com/Qwental/port-scanner-alert-system/internal/outbox"
+	"github.com/Qwental/port-scanner-alert-system/internal/report"
+	"github.com/Qwental/port-scanner-alert-system/internal/routing"
+	"github.com/Qwental/port-scanner-alert-system/internal/scheduler"
+	"github.com/Qwental/port-scanner-alert-system/internal/storage/sqlite"
+	"github.com/Qwental/port-scanner-alert-system/internal/target"
+	"go.uber.org/zap"
+)
+
+// app is everything built from one version of the config. On reload a new
+// app is built and validated first, so an invalid config never replaces a
+// working one.
+type app struct {
+	cfg     *config.Config
+	storage *sqlite.Storage
+	log     *zap.SugaredLogger
+
+	ob              *outbox.Outbox
+	retryInterval   time.Duration
+	ds              *dispatcher
+	r               *runner
+	jobs            []*job
+	tg              *notifier.TelegramNotifier
+	heartbeatNotify []string
+	heartbeatEvery  time.Duration
+	// watchEvery is the config file polling interval, zero if disabled
+	watchEvery time.Duration
+	// group is nil in single scan mode
+	group *scheduler.Group
+
+	// botOffset is the next Telegram update to handle, kept across reloads
+	botOffset int64
+	stopBot   func()
+
+	wg sync.WaitGroup
+}
+
+func newApp(cfg *config.Config, storage *sqlite.Storage, log *zap.SugaredLogger) (*app, error) {
+	a := &app{cfg: cfg, storage: storage, log: log}
+
+	channels, err := buildChannels(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifiers config: %w", err)
+	}
+
+	ob, retryInterval, err := newOutbox(cfg.Outbox, storage, log)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbox config: %w", err)
+	}
+	a.ob, a.retryInterval = ob, retryInterval
+
+	var names, defaultNames []string
+	for _, ch := range channels {
+		ob.Register(ch.name, ch.sender())
+		names = append(names, ch.name)
+		if ch.primary {
+			defaultNames = append(defaultNames, ch.name)
+		}
+		if ch.name == channelTelegram {
+			a.tg = ch.tg
+		}
+	}
+
+	classifier, err := newClassifier(cfg.Severity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid severity config: %w", err)
+	}
+
+	router, err := routing.New(cfg.Routing, cfg.TargetGroups, classifier, names, defaultNames)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing config: %w", err)
+	}
+
+	a.ds = &dispatcher{
+		channels:   channels,
+		router:     router,
+		classifier: classifier,
+		ob:         ob,
+		storage:    storage,
+		bot:        cfg.Telegram.Bot,
+		project:    cfg.ProjectName,
+		log:        log,
+	}
+
+	var checker health.Checker
+	healthNotify := defaultNames
+	if cfg.Health.Enabled {
+		checker = health.Checker{
+			AlertOnError:     cfg.Health.AlertOnError,
+			FailureThreshold: cfg.Health.FailureThreshold,
+			DropPercent:      cfg.Health.DropPercent,
+			MinPrevious:      cfg.Health.MinPrevious,
+		}
+		if len(cfg.Health.Notify) > 0 {
+			healthNotify = cfg.Health.Notify
+		}
+		for _, n := range healthNotify {
+			if !slices.Contains(names, n) {
+				return nil, fmt.Errorf("invalid health config: unknown notifier %q", n)
+			}
+		}
+	}
+
+	a.heartbeatNotify = defaultNames
+	if len(cfg.Heartbeat.Notify) > 0 {
+		a.heartbeatNotify = cfg.Heartbeat.Notify
+	}
+	for _, n := range a.heartbeatNotify {
+		if !slices.Contains(names, n) {
+			return nil, fmt.Errorf("invalid heartbeat config: unknown notifier %q", n)
+		}
+	}
+	if cfg.Heartbeat.Interval != "" {
+		if a.heartbeatEvery, err = time.ParseDuration(cfg.Heartbeat.Interval); err != nil {
+			return nil, fmt.Errorf("invalid heartbeat interval %q: %w", cfg.Heartbeat.Interval, err)
+		}
+	}
+
+	if cfg.Reload.Watch {
+		a.watchEvery = 10 * time.Second
+		if cfg.Reload.Interval != "" {
+			if a.watchEvery, err = time.ParseDuration(cfg.Reload.Interval); err != nil || a.watchEvery <= 0 {
+				return nil, fmt.Errorf("invalid reload interval %q", cfg.Reload.Interval)
+			}
+		}
+	}
+
+	var pinger *heartbeat.Pinger
+	if cfg.Heartbeat.PingURL != "" {
+		pinger = heartbeat.NewPinger(cfg.Heartbeat.PingURL, log)
+	}
+
+	windows, err := maintenance.Parse(cfg.Maintenance, cfg.TargetGroups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance config: %w", err)
+	}
+
+	exclude := cfg.Exclude
+	if cfg.ExcludeFile != "" {
+		lines, err := target.ReadFile(cfg.ExcludeFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_file: %w", err)
+		}
+		exclude = slices.Concat(exclude, lines)
+	}
+
+	a.r = &runner{
+		storage:      storage,
+		ds:           a.ds,
+		checker:      checker,
+		healthNotify: healthNotify,
+		pinger:       pinger,
+		windows:      windows,
+		exclude:      exclude,
+		resolver:     net.DefaultResolver,
+		dnsNotify:    defaultNames,
+		log:          log,
+	}
+
+	seen := make(map[string]bool)
+	for _, jc := range cfg.EffectiveJobs() {
+		if jc.Name == "" {
+			return nil, errors.New("invalid jobs config: job without a name")
+		}
+		if seen[jc.Name] {
+			return nil, fmt.Errorf("invalid jobs config: duplicate job %q", jc.Name)
+		}
+		seen[jc.Name] = true
+
+		for _, n := range jc.Notify {
+			if !slices.Contains(names, n) {
+				return nil, fmt.Errorf("invalid job %q: unknown notifier %q", jc.Name, n)
+			}
+		}
+
+		j, err := a.r.newJob(jc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job %q: %w", jc.Name, err)
+		}
+		a.jobs = append(a.jobs, j)
+	}
+
+	if !cfg.Scheduler.Enabled {
+		return a, nil
+	}
+
+	a.group = scheduler.NewGroup()
+	for _, j := range a.jobs {
+		schedule, err := scheduler.FromConfig(j.cfg.Scheduler)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scheduler config of job %q: %w", j.cfg.Name, err)
+		}
+		opts, err := scheduler.OptionsFromConfig(j.cfg.Scheduler)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scheduler config of job %q: %w", j.cfg.Name, err)
+		}
+		opts.Name = j.cfg.Name
+		opts.Store = storage
+
+		j.log.Infof("Scheduler mode: %s, overlap: %s", schedule, opts.Overlap)
+		a.group.Add(j.cfg.Name, scheduler.New(schedule, a.r.Task(j), opts, j.log))
+	}
+
+	return a, nil
+}
+
+// start launches the background workers of scheduler mode: delivery,
+// maintenance, heartbeat, control interface and the telegram bot. They stop
+// when ctx is done; wait blocks until they have.
+func (a *app) start(ctx context.Context) {
+	a.goRun(func() { a.ob.Run(ctx, a.retryInterval) })
+	a.goRun(func() { a.ds.Run(ctx, time.Minute) })
+	if len(a.r.windows) > 0 {
+		a.goRun(func() { a.r.RunMaintenance(ctx, time.Minute) })
+	}
+
+	if a.heartbeatEvery > 0 {
+		a.log.Infof("Heartbeat every %s", a.heartbeatEvery)
+		a.goRun(func() { heartbeat.Run(ctx, a.heartbeatEvery, a.sendHeartbeat) })
+	}
+
+	if a.cfg.Control.Listen != "" {
+		srv := control.New(a.cfg.Control.Listen, a.group, a.log)
+		a.goRun(func() {
+			if err := srv.Run(ctx); err != nil {
+				a.log.Errorf("Control interface failed: %v", err)
+			}
+		})
+	}
+
+	if a.tg != nil && a.cfg.Telegram.Bot {
+		botCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		a.stopBot = func() {
+			cancel()
+			<-done
+		}
+		a.goRun(func() {
+			defer close(done)
+			a.botOffset = a.tg.RunBot(botCtx, a.botOffset, a.cfg.Telegram.AllowedChatIDs, a.botHandlers())
+		})
+	}
+}
+
+func (a *app) goRun(fn func()) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		fn()
+	}()
+}
+
+func (a *app) wait() {
+	a.wg.Wait()
+}
+
+// trigger queues an immediate run of a job, or of all jobs if name is empty,
+// and returns a human-readable result.
+func (a *app) trigger(name string) string {
+	queued, err := a.group.Trigger(name)
+	if len(queued) == 0 {
+		return fmt.Sprintf("Scan rejected: %v", err)
+	}
+	reply := fmt.Sprintf("Scan triggered: %s", strings.Join(queued, ", "))
+	if err != nil {
+		reply += fmt.Sprintf("\nRejected: %v", err)
+	}
+	return reply
+}
+
+func (a *app) sendHeartbeat(ctx context.Context) {
+	run := a.r.Last()
+	if run.StartedAt.IsZero() {
+		if stored, ok, err := a.storage.LastRun("", false); err == nil && ok {
+			run = stored
+		}
+	}
+
+	ports, err := a.storage.GetAll()
+	if err != nil {
+		a.log.Errorf("Heartbeat: %v", err)
+	}
+	a.ds.SendNotice(ctx, a.heartbeatNotify, heartbeatTitle, heartbeat.Message(run.StartedAt, run.Err, len(ports)))
+}
+
+func (a *app) botHandlers() notifier.BotHandlers {
+	return notifier.BotHandlers{
+		Status: func() string {
+			return report.BuildStatusTelegram(a.r.LastRuns(), a.group.States())
+		},
+		Scan: func(name string) string {
+			return html.EscapeString(a.trigger(name))
+		},
+		Host: func(ip string) string {
+			if addr, err := netip.ParseAddr(strings.Trim(ip, "[]")); err == nil {
+				ip = addr.Unmap().String()
+			}
+			results, err := a.storage.GetByIP(ip)
+			if err != nil {
+				a.log.Errorf("Host lookup failed: %v", err)
+				return "Lookup failed, see logs"
+			}
+			return report.BuildHostTelegram(ip, results)
+		},
+		Ack: func(alertID int64, by string) string {
+			ok, err := a.storage.AckAlert(alertID, by)
+			if err != nil {
+				a.log.Errorf("Ack failed: %v", err)
+				return "Ack failed, see logs"
+			}
+			if !ok {
+				return fmt.Sprintf("Alert #%d is already acknowledged", alertID)
+			}
+			a.log.Infof("Alert #%d acknowledged by %s", alertID, by)
+			return fmt.Sprintf("Alert #%d acknowledged by %s", alertID, html.EscapeString(by))
+		},
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/delivery"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/notifier"
+	"github.com/Qwental/port-scanner-alert-system/internal/outbox"
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
+	"github.com/Qwental/port-scanner-alert-system/internal/report"
+	"github.com/Qwental/port-scanner-alert-system/internal/storage/sqlite"
+	"go.uber.org/zap"
+)
+
+const (
+	channelTelegram = "telegram"
+	channelEmail    = "email"
+)
+
+const (
+	healthTitle    = "Port Scanner Health Alert"
+	heartbeatTitle = "Port Scanner Heartbeat"
+	dnsTitle       = "Port Scanner DNS Change"
+)
+
+// alertChannel is a named notifier instance; exactly one of tg and em is set.
+type alertChannel struct {
+	name    string
+	primary bool
+	tg      *notifier.TelegramNotifier
+	em      *notifier.EmailNotifier
+	smtp    config.SMTPConfig
+	policy  delivery.Policy
+	tmpl    *report.Templates
+}
+
+func (ch alertChannel) sender() outbox.Sender {
+	if ch.tg != nil {
+		return ch.tg
+	}
+	return ch.em
+}
+
+// buildChannels creates the top-level telegram/email notifiers and the
+// named instances from cfg.Notifiers.
+func buildChannels(cfg *config.Config, log *zap.SugaredLogger) ([]alertChannel, error) {
+	var channels []alertChannel
+
+	if cfg.Telegram.Enabled && cfg.Telegram.Token != "" {
+		policy, tmpl, err := channelOptions(cfg.Telegram.Delivery, cfg.Telegram.Templates)
+		if err != nil {
+			return nil, fmt.Errorf("telegram: %w", err)
+		}
+		channels = append(channels, alertChannel{
+			name:    channelTelegram,
+			primary: true,
+			tg:      notifier.NewTelegramNotifier(cfg.Telegram.Token, cfg.Telegram.ChatID, log),
+			policy:  policy,
+			tmpl:    tmpl,
+		})
+		log.Info("Telegram notifier enabled")
+	}
+
+	if cfg.SMTP.Enabled {
+		policy, tmpl, err := channelOptions(cfg.SMTP.Delivery, cfg.SMTP.Templates)
+		if err != nil {
+			return nil, fmt.Errorf("smtp: %w", err)
+		}
+		channels = append(channels, alertChannel{
+			name:    channelEmail,
+			primary: true,
+			em:      notifier.NewEmailNotifier(cfg.SMTP, log),
+			smtp:    cfg.SMTP,
+			policy:  policy,
+			tmpl:    tmpl,
+		})
+		log.Info("Email notifier enabled")
+	}
+
+	seen := map[string]bool{channelTelegram: true, channelEmail: true}
+	for _, nc := range cfg.Notifiers {
+		if nc.Name == "" {
+			return nil, fmt.Errorf("notifier without name")
+		}
+		if seen[nc.Name] {
+			return nil, fmt.Errorf("duplicate notifier name %q", nc.Name)
+		}
+		seen[nc.Name] = true
+
+		policy, tmpl, err := channelOptions(nc.Delivery, nc.Templates)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", nc.Name, err)
+		}
+
+		switch nc.Type {
+		case "telegram":
+			if cfg.Telegram.Token == "" {
+				return nil, fmt.Errorf("notifier %q: telegram token is not set", nc.Name)
+			}
+			channels = append(channels, alertChannel{
+				name:   nc.Name,
+				tg:     notifier.NewTelegramNotifier(cfg.Telegram.Token, nc.ChatID, log),
+				policy: policy,
+				tmpl:   tmpl,
+			})
+		case "email":
+			if cfg.SMTP.Host == "" {
+				return nil, fmt.Errorf("notifier %q: smtp host is not set", nc.Name)
+			}
+			smtpCfg := cfg.SMTP
+			smtpCfg.To, smtpCfg.Cc, smtpCfg.Bcc = nc.To, nc.Cc, nc.Bcc
+			channels = append(channels, alertChannel{
+				name:   nc.Name,
+				em:     notifier.NewEmailNotifier(smtpCfg, log),
+				smtp:   smtpCfg,
+				policy: policy,
+				tmpl:   tmpl,
+			})
+		default:
+			return nil, fmt.Errorf("notifier %q: unknown type %q", nc.Name, nc.Type)
+		}
+		log.Infof("Notifier %s (%s) enabled", nc.Name, nc.Type)
+	}
+
+	return channels, nil
+}
+
+func channelOptions(dc config.DeliveryConfig, tc config.TemplatesConfig) (delivery.Policy, *report.Templates, error) {
+	policy, err := delivery.ParsePolicy(dc)
+	if err != nil {
+		return policy, nil, fmt.Errorf("delivery: %w", err)
+	}
+
+	tmpl, err := report.LoadTemplates(tc.Subject, tc.Text, tc.HTML)
+	if err != nil {
+		return policy, nil, fmt.Errorf("templates: %w", err)
+	}
+	return policy, tmpl, nil
+}
+
+func newClassifier(cfg config.SeverityConfig) (diff.Classifier, error) {
+	var (
+		c   diff.Classifier
+		err error
+	)
+	if c.Critical, err = portset.Parse(cfg.CriticalPorts); err != nil {
+		return c, fmt.Errorf("critical_ports: %w", err)
+	}
+	if c.High, err = portset.Parse(cfg.HighPorts); err != nil {
+		return c, fmt.Errorf("high_ports: %w", err)
+	}
+	return c, nil
+}
+
+// telegramText renders the diff with the channel's templates, falling
+// back to the built-in Telegram renderer.
+func telegramText(tmpl *report.Templates, data report.TemplateData, d diff.DiffResult) (string, error) {
+	text, err := tmpl.Text(data, "")
+	if err != nil {
+		return "", err
+	}
+
+	fallback := report.BuildDiffTelegram(d)
+	if text != "" {
+		fallback = html.EscapeString(text)
+	}
+	return tmpl.HTML(data, fallback)
+}
+
+// telegramPayload wraps the rendered text; with the bot enabled the alert
+// is stored first so it can be acknowledged from the inline button.
+func telegramPayload(storage *sqlite.Storage, bot bool, text string, d diff.DiffResult, log *zap.SugaredLogger) notifier.TelegramPayload {
+	payload := notifier.TelegramPayload{Text: text}
+	if !bot {
+		return payload
+	}
+
+	summary := fmt.Sprintf("%d new, %d changed, %d closed", len(d.New), len(d.Changed), len(d.Closed))
+	id, err := storage.SaveAlert(summary)
+	if err != nil {
+		log.Errorf("Save alert failed, sending without ack button: %v", err)
+		return payload
+	}
+	payload.AlertID = id
+	return payload
+}
+
+// buildEmail renders the alert email with the channel's templates. With
+// attachments enabled and more than MaxBodyChanges changes the full diff and
+// scan report are attached and the built-in body is limited to MaxBodyChanges.
+func buildEmail(cfg config.SMTPConfig, tmpl *report.Templates, data report.TemplateData, d diff.DiffResult, results []model.ScanResult) (notifier.Message, error) {
+	var (
+		msg notifier.Message
+		err error
+	)
+
+	attach := cfg.Attachments && d.Total() > cfg.MaxBodyChanges
+	text, htmlBody := report.BuildDiffReport(d), report.BuildDiffHTML(d)
+	if attach {
+		text, htmlBody = report.BuildDiffTop(d, cfg.MaxBodyChanges)
+	}
+
+	if msg.Subject, err = tmpl.Subject(data, "Port Scanner Alert"); err != nil {
+		return msg, err
+	}
+	if msg.Text, err = tmpl.Text(data, text); err != nil {
+		return msg, err
+	}
+	if msg.HTML, err = tmpl.HTML(data, htmlBody); err != nil {
+		return msg, err
+	}
+
+	if !attach {
+		return msg, nil
+	}
+
+	files := []struct {
+		name, contentType string
+		build             func() ([]byte, error)
+	}{
+		{"diff.csv", "text/csv", func() ([]byte, error) { return report.BuildDiffCSV(d) }},
+		{"diff.json", "application/json", func() ([]byte, error) { return report.BuildDiffJSON(d) }},
+		{"scan.csv", "text/csv", func() ([]byte, error) { return report.BuildScanCSV(results) }},
+		{"scan.json", "application/json", func() ([]byte, error) { return report.BuildScanJSON(results) }},
+	}
+
+	for _, f := range files {
+		data, err := f.build()
+		if err != nil {
+			return msg, fmt.Errorf("build %s: %w", f.name, err)
+		}
+		msg.Attachments = append(msg.Attachments, notifier.Attachment{
+			Name:        f.name,
+			ContentType: f.contentType,
+			Data:        data,
+		})
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"go.uber.org/zap"
+)
+
+const usage = `Usage:
+  scanner [flags]                      run scans
+  scanner [flags] config check [path]  validate the config and exit
+  scanner [flags] config print [path]  print the effective config, secrets masked
+  scanner config env                   list the PSAS_* environment variables
+
+Flags:`
+
+// options are the command line flags.
+type options struct {
+	configPath string
+	// sets are "path=value" overrides applied on top of file and environment
+	sets setFlags
+}
+
+type setFlags []string
+
+func (s *setFlags) String() string { return strings.Join(*s, ",") }
+
+func (s *setFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func parseFlags() (options, []string) {
+	var opts options
+
+	fs := flag.NewFlagSet("scanner", flag.ExitOnError)
+	fs.StringVar(&opts.configPath, "config", "", "config file (default $CONFIG_PATH or config/config.yaml)")
+	fs.Var(&opts.sets, "set", "override a setting, e.g. -set masscan.rate=500 (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+
+	if opts.configPath == "" {
+		opts.configPath = os.Getenv("CONFIG_PATH")
+	}
+	if opts.configPath == "" {
+		opts.configPath = "config/config.yaml"
+	}
+	return opts, fs.Args()
+}
+
+func (o options) load() (*config.Config, error) {
+	return config.LoadConfig(o.configPath, o.sets...)
+}
+
+// runCommand executes a subcommand and returns the exit code.
+func runCommand(opts options, args []string) int {
+	if len(args) >= 2 && args[0] == "config" {
+		if len(args) == 3 {
+			opts.configPath = args[2]
+		}
+		switch {
+		case args[1] == "check" && len(args) <= 3:
+			return checkConfig(opts)
+		case args[1] == "print" && len(args) <= 3:
+			return printConfig(opts)
+		case args[1] == "env" && len(args) == 2:
+			for _, name := range config.EnvVars() {
+				fmt.Println(name)
+			}
+			return 0
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, usage)
+	return 2
+}
+
+// checkConfig validates the file and builds everything the daemon would
+// build from it, without opening the database or starting scans.
+func checkConfig(opts options) int {
+	cfg, ok := loadForCommand(opts)
+	if !ok {
+		return 1
+	}
+
+	if _, err := newApp(cfg, nil, zap.NewNop().Sugar()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", opts.configPath, err)
+		return 1
+	}
+
+	fmt.Printf("%s: OK\n", opts.configPath)
+	return 0
+}
+
+func printConfig(opts options) int {
+	cfg, ok := loadForCommand(opts)
+	if !ok {
+		return 1
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func loadForCommand(opts options) (*config.Config, bool) {
+	cfg, err := opts.load()
+	if err == nil {
+		return cfg, true
+	}
+
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		for _, p := range verr.Problems {
+			fmt.Fprintln(os.Stderr, p.String(verr.File))
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return nil, false
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/delivery"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/notifier"
+	"github.com/Qwental/port-scanner-alert-system/internal/outbox"
+	"github.com/Qwental/port-scanner-alert-system/internal/report"
+	"github.com/Qwental/port-scanner-alert-system/internal/routing"
+	"github.com/Qwental/port-scanner-alert-system/internal/storage/sqlite"
+	"go.uber.org/zap"
+)
+
+// dispatcher routes diffs to channels and applies their delivery policies:
+// changes are either put into the outbox right away or queued in storage
+// until the policy says they are due.
+type dispatcher struct {
+	mu         sync.Mutex
+	channels   []alertChannel
+	router     *routing.Router
+	classifier diff.Classifier
+	ob         *outbox.Outbox
+	storage    *sqlite.Storage
+	bot        bool
+	project    string
+	log        *zap.SugaredLogger
+}
+
+// Dispatch delivers the diff of a run. A non-empty notify list sends the
+// whole diff to these channels instead of applying routing rules.
+func (ds *dispatcher) Dispatch(ctx context.Context, d diff.DiffResult, results []model.ScanResult, notify []string) {
+	ds.mu.Lock()
+	now := time.Now()
+
+	routed := make(map[string]diff.DiffResult)
+	if len(notify) > 0 {
+		for _, n := range notify {
+			routed[n] = d
+		}
+	} else {
+		routed = ds.router.Route(d)
+	}
+
+	for _, ch := range ds.channels {
+		sub := routed[ch.name]
+		if sub.Total() == 0 {
+			continue
+		}
+
+		if ch.policy.Immediate() && !ch.policy.Quiet(now) {
+			ds.send(ch, sub, results)
+			continue
+		}
+
+		var urgent diff.DiffResult
+		var queued []model.QueuedChange
+		sub.Each(func(change diff.Change, r model.ScanResult) {
+			if ch.policy.Bypasses(ds.classifier.Severity(change, r)) {
+				urgent.Add(change, r)
+				return
+			}
+			queued = append(queued, model.QueuedChange{Channel: ch.name, Change: string(change), Result: r})
+		})
+
+		if urgent.Total() > 0 {
+			ds.send(ch, urgent, results)
+		}
+		if len(queued) > 0 {
+			ds.queue(ch, queued, now)
+		}
+	}
+	ds.mu.Unlock()
+
+	ds.FlushQueued(ctx)
+}
+
+func (ds *dispatcher) send(ch alertChannel, d diff.DiffResult, results []model.ScanResult) {
+	if err := ds.enqueue(ch, d, results); err != nil {
+		ds.log.Errorf("Notifier %s: %v", ch.name, err)
+	}
+}
+
+// enqueue renders the diff for the channel and stores it in the outbox.
+// Ack buttons are attached only for the top-level telegram notifier,
+// since only its bot handles callbacks.
+func (ds *dispatcher) enqueue(ch alertChannel, d diff.DiffResult, results []model.ScanResult) error {
+	data := report.NewTemplateData(ds.project, d, results, ds.classifier)
+
+	if ch.tg != nil {
+		text, err := telegramText(ch.tmpl, data, d)
+		if err != nil {
+			return err
+		}
+		payload := telegramPayload(ds.storage, ds.bot && ch.name == channelTelegram, text, d, ds.log)
+		return ds.ob.Enqueue(ch.name, payload)
+	}
+
+	msg, err := buildEmail(ch.smtp, ch.tmpl, data, d, results)
+	if err != nil {
+		return fmt.Errorf("build email: %w", err)
+	}
+	return ds.ob.Enqueue(ch.name, msg)
+}
+
+func (ds *dispatcher) queue(ch alertChannel, changes []model.QueuedChange, now time.Time) {
+	waiting, err := ds.storage.HasPendingChanges(ch.name)
+	if err != nil {
+		ds.log.Errorf("Notifier %s: %v", ch.name, err)
+		return
+	}
+	if err := ds.storage.QueueChanges(changes); err != nil {
+		ds.log.Errorf("Notifier %s: %v", ch.name, err)
+		return
+	}
+	ds.log.Infof("Notifier %s: %d changes queued by delivery policy", ch.name, len(changes))
+
+	// the first queued change starts the batch/digest window, so a change
+	// after an idle spell waits for the next batch or digest time
+	if !waiting {
+		if err := ds.storage.SetLastFlush(ch.name, now); err != nil {
+			ds.log.Errorf("Notifier %s: %v", ch.name, err)
+		}
+	}
+}
+
+// FlushQueued sends queued changes of every channel whose policy is due,
+// then flushes the outbox.
+func (ds *dispatcher) FlushQueued(ctx context.Context) {
+	ds.mu.Lock()
+	defer ds.ob.Flush(ctx)
+	defer ds.mu.Unlock()
+
+	now := time.Now()
+	var current map[string]model.ScanResult
+
+	for _, ch := range ds.channels {
+		pending, err := ds.storage.PendingChanges(ch.name)
+		if err != nil {
+			ds.log.Errorf("Notifier %s: %v", ch.name, err)
+			continue
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		last, err := ds.storage.LastFlush(ch.name)
+		if err != nil {
+			ds.log.Errorf("Notifier %s: %v", ch.name, err)
+			continue
+		}
+		if !ch.policy.Due(now, last) {
+			continue
+		}
+
+		if current == nil {
+			if current, err = ds.storage.GetAll(); err != nil {
+				ds.log.Errorf("Load current state failed: %v", err)
+				return
+			}
+		}
+
+		d := delivery.Merge(pending)
+		ds.log.Infof("Notifier %s: sending %d queued changes (%d merged)", ch.name, d.Total(), len(pending))
+		if d.Total() > 0 {
+			ds.send(ch, d, alertResults(current, d))
+		}
+
+		if err := ds.storage.DeletePendingChanges(ch.name, pending[len(pending)-1].ID); err != nil {
+			ds.log.Errorf("Notifier %s: %v", ch.name, err)
+		}
+		if err := ds.storage.SetLastFlush(ch.name, now); err != nil {
+			ds.log.Errorf("Notifier %s: %v", ch.name, err)
+		}
+	}
+}
+
+// alertResults returns the stored ports of the hosts in d, the scan report
+// of an alert sent later than the run that found the changes.
+func alertResults(current map[string]model.ScanResult, d diff.DiffResult) []model.ScanResult {
+	hosts := make(map[string]bool)
+	d.Each(func(_ diff.Change, r model.ScanResult) {
+		hosts[r.IP] = true
+	})
+
+	var out []model.ScanResult
+	for _, r := range current {
+		if hosts[r.IP] {
+			out = append(out, r)
+		}
+	}
+	slices.SortFunc(out, func(a, b model.ScanResult) int {
+		return strings.Compare(a.Key(), b.Key())
+	})
+	return out
+}
+
+// Run checks queued changes every interval until ctx is done.
+func (ds *dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ds.FlushQueued(ctx)
+		}
+	}
+}
+
+// SendNotice sends a service message (health alert, heartbeat) to the named
+// channels, bypassing routing rules and delivery policies.
+func (ds *dispatcher) SendNotice(ctx context.Context, names []string, title, text string) {
+	wanted := make(map[string]bool, len(names))
+	for _, n := range names {
+		wanted[n] = true
+	}
+
+	for _, ch := range ds.channels {
+		if !wanted[ch.name] {
+			continue
+		}
+
+		var err error
+		if ch.tg != nil {
+			err = ds.ob.Enqueue(ch.name, notifier.TelegramPayload{
+				Text: "<b>" + title + "</b>\n<pre>" + html.EscapeString(text) + "</pre>",
+			})
+		} else {
+			err = ds.ob.Enqueue(ch.name, notifier.Message{
+				Subject: title,
+				Text:    text,
+				HTML:    "<h2>" + title + "</h2><pre>" + html.EscapeString(text) + "</pre>",
+			})
+		}
+		if err != nil {
+			ds.log.Errorf("Notifier %s: %v", ch.name, err)
+		}
+	}
+
+	ds.ob.Flush(ctx)
+}
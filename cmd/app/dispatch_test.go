@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/delivery"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+func TestAlertResults(t *testing.T) {
+	current := make(map[string]model.ScanResult)
+	for _, r := range []model.ScanResult{
+		{IP: "10.0.0.1", Port: 22, Proto: "tcp"},
+		{IP: "10.0.0.1", Port: 443, Proto: "tcp"},
+		{IP: "10.0.0.2", Port: 53, Proto: "udp"},
+		{IP: "10.0.9.9", Port: 80, Proto: "tcp"},
+	} {
+		current[r.Key()] = r
+	}
+
+	d := diff.DiffResult{
+		New:    []model.ScanResult{{IP: "10.0.0.1", Port: 443, Proto: "tcp"}},
+		Closed: []model.ScanResult{{IP: "10.0.0.2", Port: 161, Proto: "udp"}},
+	}
+	got := alertResults(current, d)
+
+	want := []string{"10.0.0.1:22/tcp", "10.0.0.1:443/tcp", "10.0.0.2:53/udp"}
+	if len(got) != len(want) {
+		t.Fatalf("alertResults = %v, want %v", got, want)
+	}
+	for i, r := range got {
+		if r.Key() != want[i] {
+			t.Errorf("result %d = %s, want %s", i, r.Key(), want[i])
+		}
+	}
+
+	if got := alertResults(current, diff.DiffResult{}); len(got) != 0 {
+		t.Errorf("alertResults of an empty diff = %v", got)
+	}
+}
+
+func TestQueueStartsWindow(t *testing.T) {
+	storage := newTestStorage(t)
+	ds := &dispatcher{storage: storage, log: zap.NewNop().Sugar()}
+
+	policy, err := delivery.ParsePolicy(config.DeliveryConfig{Mode: delivery.ModeBatch, Every: "30m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := alertChannel{name: "email", policy: policy}
+	change := func(port int) []model.QueuedChange {
+		return []model.QueuedChange{{
+			Channel: ch.name,
+			Change:  string(diff.ChangeNew),
+			Result:  model.ScanResult{IP: "10.0.0.1", Port: port, Proto: "tcp"},
+		}}
+	}
+
+	// the last batch went out long ago
+	now := time.Now().Truncate(time.Second)
+	if err := storage.SetLastFlush(ch.name, now.Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	ds.queue(ch, change(22), now)
+	last, err := storage.LastFlush(ch.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Equal(now) {
+		t.Fatalf("last flush = %s, want the first queued change at %s", last, now)
+	}
+	if ch.policy.Due(now.Add(time.Minute), last) {
+		t.Error("change after an idle spell is due at once, want it to wait for the batch")
+	}
+
+	// a change joining a waiting batch does not move its window
+	ds.queue(ch, change(80), now.Add(10*time.Minute))
+	if last, err = storage.LastFlush(ch.name); err != nil || !last.Equal(now) {
+		t.Errorf("last flush = %s %v after a second change, want %s", last, err, now)
+	}
+	if !ch.policy.Due(now.Add(30*time.Minute), last) {
+		t.Error("batch not due when its window is over")
+	}
+}
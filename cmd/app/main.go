@@ -9,16 +9,18 @@ import (
 	"time"
 
 	"github.com/Qwental/port-scanner-alert-system/internal/config"
-	"github.com/Qwental/port-scanner-alert-system/internal/diff"
 	"github.com/Qwental/port-scanner-alert-system/internal/logger"
-	"github.com/Qwental/port-scanner-alert-system/internal/notifier"
-	"github.com/Qwental/port-scanner-alert-system/internal/report"
-	"github.com/Qwental/port-scanner-alert-system/internal/scanner"
-	"github.com/Qwental/port-scanner-alert-system/internal/scheduler"
+	"github.com/Qwental/port-scanner-alert-system/internal/outbox"
 	"github.com/Qwental/port-scanner-alert-system/internal/storage/sqlite"
+	"go.uber.org/zap"
 )
 
 func main() {
+	opts, args := parseFlags()
+	if len(args) > 0 {
+		os.Exit(runCommand(opts, args))
+	}
+
 	log := logger.InitLogger()
 	defer log.Sync()
 
@@ -28,12 +30,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	cfgPath := os.Getenv("CONFIG_PATH")
-	if cfgPath == "" {
-		cfgPath = "config/config.yaml"
-	}
-
-	cfg, err := config.LoadConfig(cfgPath)
+	cfg, err := opts.load()
 	if err != nil {
 		log.Errorf("Failed to load config: %v", err)
 		log.Sync()
@@ -48,69 +45,11 @@ func main() {
 	}
 	defer storage.Close()
 
-	scn := scanner.NewMasscanWrapper(cfg.Masscan, log)
-
-	var tg *notifier.TelegramNotifier
-	if cfg.Telegram.Enabled && cfg.Telegram.Token != "" {
-		tg = notifier.NewTelegramNotifier(cfg.Telegram.Token, cfg.Telegram.ChatID, log)
-		log.Info("Telegram notifier enabled")
-	}
-
-	var em *notifier.EmailNotifier
-	if cfg.SMTP.Enabled && cfg.SMTP.User != "" {
-		em = notifier.NewEmailNotifier(
-			cfg.SMTP.Host, cfg.SMTP.Port,
-			cfg.SMTP.User, cfg.SMTP.Password,
-			cfg.SMTP.From, log,
-		)
-		log.Info("Email notifier enabled")
-	}
-
-	task := func(ctx context.Context) error {
-		previous, err := storage.GetAll()
-		if err != nil {
-			return fmt.Errorf("load previous state: %w", err)
-		}
-
-		results, err := scn.Run(ctx, cfg.Targets)
-		if err != nil {
-			return fmt.Errorf("scan: %w", err)
-		}
-
-		d := diff.Compare(results, previous)
-		log.Infof("Results: %d ports | Diff: %d new, %d changed, %d closed",
-			len(results), len(d.New), len(d.Changed), len(d.Closed))
-
-		if len(results) > 0 {
-			if err := storage.Upsert(results); err != nil {
-				log.Errorf("Save failed: %v", err)
-			}
-		}
-
-		fmt.Println(report.BuildScanReport(results))
-		diffText := report.BuildDiffReport(d)
-		fmt.Println(diffText)
-
-		hasChanges := len(d.New) > 0 || len(d.Changed) > 0 || len(d.Closed) > 0
-		if !hasChanges {
-			log.Info("No changes, skipping notifications")
-			return nil
-		}
-
-		if tg != nil {
-			if err := tg.Send(diffText); err != nil {
-				log.Errorf("Telegram failed: %v", err)
-			}
-		}
-
-		if em != nil {
-			htmlBody := report.BuildDiffHTML(d)
-			if err := em.Send(cfg.SMTP.To, "Port Scanner Alert", htmlBody); err != nil {
-				log.Errorf("Email failed: %v", err)
-			}
-		}
-
-		return nil
+	a, err := newApp(cfg, storage, log)
+	if err != nil {
+		log.Errorf("Invalid config: %v", err)
+		log.Sync()
+		os.Exit(1)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -124,22 +63,53 @@ func main() {
 		cancel()
 	}()
 
+	// deliver whatever was left from the previous process
+	a.ds.FlushQueued(ctx)
+	a.r.FlushMaintenance(ctx)
+
 	if cfg.Scheduler.Enabled {
-		interval, err := time.ParseDuration(cfg.Scheduler.Interval)
-		if err != nil {
-			log.Errorf("Invalid interval %q: %v", cfg.Scheduler.Interval, err)
-			log.Sync()
-			os.Exit(1)
-		}
-		log.Infof("Scheduler mode: every %s", interval)
-		s := scheduler.New(interval, task, log)
-		s.Run(ctx)
+		serve(ctx, a, opts)
 	} else {
+		if cfg.Telegram.Bot {
+			log.Warn("Telegram bot requires scheduler mode, ignoring")
+		}
 		log.Info("Single scan mode")
-		if err := task(ctx); err != nil {
-			log.Errorf("Task failed: %v", err)
+		for _, j := range a.jobs {
+			if err := a.r.Task(j)(ctx); err != nil {
+				j.log.Errorf("Task failed: %v", err)
+			}
+			if ctx.Err() != nil {
+				break
+			}
 		}
 	}
 
 	log.Info("Goodbye!")
-}
\ No newline at end of file
+}
+
+func newOutbox(cfg config.OutboxConfig, storage *sqlite.Storage, log *zap.SugaredLogger) (*outbox.Outbox, time.Duration, error) {
+	opts := outbox.Options{MaxAttempts: cfg.MaxAttempts}
+	retryInterval := 30 * time.Second
+
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"base_delay", cfg.BaseDelay, &opts.BaseDelay},
+		{"max_delay", cfg.MaxDelay, &opts.MaxDelay},
+		{"retry_interval", cfg.RetryInterval, &retryInterval},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s %q: %w", d.name, d.value, err)
+		}
+		*d.dst = v
+	}
+
+	return outbox.New(storage, opts, log), retryInterval, nil
+}
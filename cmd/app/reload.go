@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/scheduler"
+)
+
+// serve runs the schedulers and workers of a until ctx is done. SIGUSR1
+// triggers all jobs. SIGHUP, or a change of the config file with
+// reload.watch, loads the config again: if it is valid, the old schedulers
+// stop, scans in progress finish, and the new app takes over. An invalid
+// config is logged and the old one stays in effect.
+func serve(ctx context.Context, a *app, opts options) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	changed := make(chan struct{}, 1)
+
+	for {
+		workersCtx, stopWorkers := context.WithCancel(ctx)
+		a.start(workersCtx)
+		if a.watchEvery > 0 {
+			a.goRun(func() { a.watch(workersCtx, opts.configPath, changed) })
+		}
+
+		stopped := make(chan struct{})
+		go func(g *scheduler.Group) {
+			g.Run(ctx)
+			close(stopped)
+		}(a.group)
+
+		next := a.waitReload(ctx, opts, usr1, hup, changed)
+		if next == nil {
+			<-stopped
+			stopWorkers()
+			a.wait()
+			return
+		}
+
+		a.log.Info("Config is valid, waiting for running scans before switching")
+		// commands must not reach a scheduler that is stopping
+		if a.stopBot != nil {
+			a.stopBot()
+		}
+		a.group.Stop()
+		<-stopped
+		stopWorkers()
+		a.wait()
+
+		next.r.inherit(a.r)
+		next.botOffset = a.botOffset
+		a = next
+		a.log.Info("New config applied")
+
+		// a change noticed by the old watcher is already applied
+		select {
+		case <-changed:
+		default:
+		}
+	}
+}
+
+// waitReload handles signals until a new valid config is loaded (returned)
+// or ctx is done (nil).
+func (a *app) waitReload(ctx context.Context, opts options, usr1, hup <-chan os.Signal, changed <-chan struct{}) *app {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-usr1:
+			a.log.Infof("SIGUSR1: %s", a.trigger(""))
+			continue
+		case <-hup:
+			a.log.Info("SIGHUP: reloading config")
+		case <-changed:
+			a.log.Info("Config file changed, reloading")
+		}
+
+		next, err := a.reload(opts)
+		if err != nil {
+			a.log.Errorf("Reload failed, keeping the current config: %v", err)
+			continue
+		}
+		return next
+	}
+}
+
+// reload loads and validates the config and builds a new app from it.
+// Settings that need a restart are kept from the current config.
+func (a *app) reload(opts options) (*app, error) {
+	cfg, err := opts.load()
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Scheduler.Enabled {
+		return nil, errors.New("scheduler.enabled cannot be turned off without a restart")
+	}
+	if cfg.Database.Path != a.cfg.Database.Path {
+		a.log.Warnf("Changing database.path requires a restart, keeping %s", a.cfg.Database.Path)
+		cfg.Database.Path = a.cfg.Database.Path
+	}
+	return newApp(cfg, a.storage, a.log)
+}
+
+// watch polls the config file and signals changed when its size or
+// modification time changes.
+func (a *app) watch(ctx context.Context, path string, changed chan<- struct{}) {
+	last, err := os.Stat(path)
+	if err != nil {
+		a.log.Errorf("Watch config: %v", err)
+	}
+
+	ticker := time.NewTicker(a.watchEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cur, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if last != nil && cur.ModTime().Equal(last.ModTime()) && cur.Size() == last.Size() {
+			continue
+		}
+		last = cur
+
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
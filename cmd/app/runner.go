@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/delivery"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/health"
+	"github.com/Qwental/port-scanner-alert-system/internal/heartbeat"
+	"github.com/Qwental/port-scanner-alert-system/internal/maintenance"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/report"
+	"github.com/Qwental/port-scanner-alert-system/internal/scanner"
+	"github.com/Qwental/port-scanner-alert-system/internal/scheduler"
+	"github.com/Qwental/port-scanner-alert-system/internal/storage/sqlite"
+	"github.com/Qwental/port-scanner-alert-system/internal/target"
+	"go.uber.org/zap"
+)
+
+// runner executes scan jobs and keeps the last run of each of them.
+type runner struct {
+	storage      *sqlite.Storage
+	ds           *dispatcher
+	checker      health.Checker
+	healthNotify []string
+	pinger       *heartbeat.Pinger
+	windows      []maintenance.Window
+	// exclude are the top-level exclusions shared by all jobs
+	exclude  []string
+	resolver target.Resolver
+	// dnsNotify receives hostname address changes of jobs without notify
+	dnsNotify []string
+	log       *zap.SugaredLogger
+
+	mu       sync.Mutex
+	jobs     []*job
+	lastRuns map[string]model.RunSummary
+}
+
+type job struct {
+	cfg     config.JobConfig
+	scn     *scanner.MasscanWrapper
+	targets target.List
+	exclude target.List
+	log     *zap.SugaredLogger
+}
+
+func (r *runner) newJob(cfg config.JobConfig) (*job, error) {
+	log := r.log.With("job", cfg.Name)
+
+	targets, overlaps, err := target.Load(cfg.Targets, cfg.TargetsFile)
+	if err == nil {
+		err = target.CheckScannable(targets.Prefixes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("targets: %w", err)
+	}
+	for _, o := range overlaps {
+		log.Warnf("Target %s, scanning it once", o)
+	}
+
+	exclude, _, err := target.Load(slices.Concat(r.exclude, cfg.Exclude), cfg.ExcludeFile)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	for _, t := range targets.Strings() {
+		if exclude.Covers(t) {
+			log.Warnf("Target %s is excluded entirely", t)
+		}
+	}
+
+	r.mu.Lock()
+	if r.lastRuns == nil {
+		r.lastRuns = make(map[string]model.RunSummary)
+	}
+	j := &job{
+		cfg:     cfg,
+		scn:     scanner.NewMasscanWrapper(cfg.Masscan, log),
+		targets: targets,
+		exclude: exclude,
+		log:     log,
+	}
+	r.jobs = append(r.jobs, j)
+	r.mu.Unlock()
+
+	return j, nil
+}
+
+func (r *runner) scan(ctx context.Context, j *job, run *model.RunSummary) error {
+	now := time.Now()
+	skip := maintenance.ActiveWindows(r.windows, maintenance.ActionSkip, now)
+
+	// hostnames are resolved on every run
+	targets, names, err := j.targets.Resolve(ctx, r.resolver)
+	unresolved := err != nil
+	if unresolved {
+		j.log.Warnf("Scanning without unresolved targets: %v", err)
+	}
+	r.trackNames(ctx, j, names)
+	exclude, _, err := j.exclude.Resolve(ctx, r.resolver)
+	if err != nil {
+		return fmt.Errorf("exclude: %w", err)
+	}
+	scope := target.NewScope(targets, exclude, string(j.cfg.Masscan.Ports), string(j.cfg.Masscan.UDPPorts))
+
+	// hosts in skip windows are excluded from the scan, not just from the diff
+	var skipPrefixes []netip.Prefix
+	for _, w := range skip {
+		skipPrefixes = append(skipPrefixes, w.Prefixes()...)
+	}
+	scanExclude := exclude.With(skipPrefixes)
+
+	var scanTargets []string
+	skipped := false
+	for _, t := range targets.Strings() {
+		if exclude.Covers(t) {
+			continue
+		}
+		if w, ok := coveringTarget(skip, t); ok {
+			j.log.Infof("Skipping %s: maintenance window %s", t, w.Name)
+			skipped = true
+			continue
+		}
+		if scanExclude.Covers(t) {
+			j.log.Infof("Skipping %s: maintenance windows", t)
+			skipped = true
+			continue
+		}
+		scanTargets = append(scanTargets, t)
+	}
+	for _, p := range skipPrefixes {
+		if slices.ContainsFunc(targets.Prefixes, p.Overlaps) {
+			skipped = true
+			break
+		}
+	}
+	if len(scanTargets) == 0 {
+		if skipped {
+			return errMaintenance
+		}
+		return errors.New("no targets left after exclusions and name resolution")
+	}
+
+	all, err := r.storage.GetAll()
+	if err != nil {
+		return fmt.Errorf("load previous state: %w", err)
+	}
+	// only compare against what this job scans, other jobs own the rest
+	previous := scope.Filter(all)
+	for k, res := range previous {
+		if _, ok := covering(skip, res); ok {
+			delete(previous, k)
+		}
+	}
+
+	results, err := j.scn.Run(ctx, scanTargets, scanExclude.Strings())
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("scan cancelled: %w", ctx.Err())
+	}
+	results = slices.DeleteFunc(results, func(res model.ScanResult) bool {
+		_, ok := covering(skip, res)
+		return ok
+	})
+
+	nameResults(results, names)
+	run.Results = len(results)
+	partial := skipped || unresolved
+	if prev, ok, err := r.storage.LastRun(j.cfg.Name, true); err != nil {
+		j.log.Errorf("Load previous run failed: %v", err)
+	} else if ok && prev.Ports != "" && prev.Ports != run.Ports {
+		// fewer results are expected when fewer ports are scanned
+		j.log.Info("Ports changed since the last run, skipping the result drop check")
+	} else if text, dropped := r.checker.Dropped(len(results), prev); ok && dropped && !partial {
+		j.log.Warnf("Suspicious result drop, skipping diff: %s", text)
+		r.ds.SendNotice(ctx, r.healthNotify, healthTitle, jobText(j.cfg.Name, text))
+		run.Suspicious = true
+		return nil
+	}
+
+	d := diff.Compare(results, previous)
+	run.New, run.Changed, run.Closed = len(d.New), len(d.Changed), len(d.Closed)
+	j.log.Infof("Results: %d ports | Diff: %d new, %d changed, %d closed",
+		len(results), len(d.New), len(d.Changed), len(d.Closed))
+
+	if len(results) > 0 {
+		if err := r.storage.Upsert(results); err != nil {
+			j.log.Errorf("Save failed: %v", err)
+		}
+	}
+	if len(d.Closed) > 0 {
+		if err := r.storage.Delete(d.Closed); err != nil {
+			j.log.Errorf("Remove closed ports failed: %v", err)
+		}
+	}
+
+	fmt.Println(report.BuildScanReport(results))
+	fmt.Println(report.BuildDiffReport(d))
+
+	d = r.hold(j, d, now)
+
+	if d.Total() == 0 {
+		j.log.Info("No changes, skipping notifications")
+		// queued changes may still be due
+		r.ds.FlushQueued(ctx)
+		return nil
+	}
+
+	r.ds.Dispatch(ctx, d, results, j.cfg.Notify)
+	return nil
+}
+
+// Task returns the scheduler task of a job.
+func (r *runner) Task(j *job) scheduler.TaskFunc {
+	return func(ctx context.Context) error {
+		run := model.RunSummary{Job: j.cfg.Name, StartedAt: time.Now(), Ports: j.scn.Ports()}
+		err := r.scan(ctx, j, &run)
+		if errors.Is(err, errMaintenance) {
+			j.log.Info("All targets are in a maintenance window, skipping scan")
+			return nil
+		}
+		if err != nil && errors.Is(context.Cause(ctx), scheduler.ErrOverlapCancelled) {
+			// not a failure of the scan, the newer run replaces it
+			j.log.Warn("Scan cancelled by the overlap policy, not recording it")
+			return nil
+		}
+		run.FinishedAt = time.Now()
+		if err != nil {
+			run.Err = err.Error()
+		}
+
+		r.mu.Lock()
+		r.lastRuns[j.cfg.Name] = run
+		r.mu.Unlock()
+
+		if saveErr := r.storage.SaveRun(run); saveErr != nil {
+			j.log.Errorf("Save run failed: %v", saveErr)
+		}
+
+		if r.pinger != nil && ctx.Err() == nil {
+			if err != nil {
+				r.pinger.Fail(ctx, jobText(j.cfg.Name, err.Error()))
+			} else {
+				r.pinger.Success(ctx)
+			}
+		}
+
+		if err != nil && ctx.Err() == nil {
+			failures, cErr := r.storage.ConsecutiveFailures(j.cfg.Name)
+			if cErr != nil {
+				j.log.Errorf("Count failed runs failed: %v", cErr)
+			} else if text, alert := r.checker.Failed(run, failures); alert {
+				r.ds.SendNotice(ctx, r.healthNotify, healthTitle, jobText(j.cfg.Name, text))
+			}
+		}
+
+		return err
+	}
+}
+
+// hold queues changes covered by active suppress windows until the window
+// ends and returns the rest.
+func (r *runner) hold(j *job, d diff.DiffResult, now time.Time) diff.DiffResult {
+	suppress := maintenance.ActiveWindows(r.windows, maintenance.ActionSuppress, now)
+	if len(suppress) == 0 {
+		return d
+	}
+
+	var rest diff.DiffResult
+	var held []model.QueuedChange
+	d.Each(func(change diff.Change, res model.ScanResult) {
+		w, ok := covering(suppress, res)
+		if !ok {
+			rest.Add(change, res)
+			return
+		}
+		held = append(held, model.QueuedChange{
+			Channel: maintenanceQueue(w.Name, j.cfg.Name),
+			Change:  string(change),
+			Result:  res,
+		})
+	})
+
+	if len(held) > 0 {
+		if err := r.storage.QueueChanges(held); err != nil {
+			j.log.Errorf("Hold changes failed: %v", err)
+			return d
+		}
+		j.log.Infof("%d changes held by maintenance windows", len(held))
+	}
+	return rest
+}
+
+// FlushMaintenance sends a summary of the changes held by every window
+// that is no longer active.
+func (r *runner) FlushMaintenance(ctx context.Context) {
+	now := time.Now()
+
+	r.mu.Lock()
+	jobs := slices.Clone(r.jobs)
+	r.mu.Unlock()
+
+	var current map[string]model.ScanResult
+	for _, w := range r.windows {
+		if w.Action != maintenance.ActionSuppress || w.Active(now) {
+			continue
+		}
+
+		for _, j := range jobs {
+			queue := maintenanceQueue(w.Name, j.cfg.Name)
+			pending, err := r.storage.PendingChanges(queue)
+			if err != nil {
+				j.log.Errorf("Load held changes failed: %v", err)
+				continue
+			}
+			if len(pending) == 0 {
+				continue
+			}
+
+			if current == nil {
+				if current, err = r.storage.GetAll(); err != nil {
+					r.log.Errorf("Load current state failed: %v", err)
+					return
+				}
+			}
+
+			d := delivery.Merge(pending)
+			j.log.Infof("Maintenance window %s ended: %d changes (%d merged)", w.Name, d.Total(), len(pending))
+			if d.Total() > 0 {
+				r.ds.Dispatch(ctx, d, alertResults(current, d), j.cfg.Notify)
+			}
+			if err := r.storage.DeletePendingChanges(queue, pending[len(pending)-1].ID); err != nil {
+				j.log.Errorf("Delete held changes failed: %v", err)
+			}
+		}
+	}
+}
+
+// RunMaintenance checks for ended maintenance windows every interval until
+// ctx is done.
+func (r *runner) RunMaintenance(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.FlushMaintenance(ctx)
+		}
+	}
+}
+
+// errMaintenance means the whole job is skipped by maintenance windows.
+var errMaintenance = errors.New("skipped by maintenance window")
+
+// maintenanceQueue is the pending_changes channel of changes held by a window.
+func maintenanceQueue(window, job string) string {
+	return "maintenance:" + window + ":" + job
+}
+
+func covering(windows []maintenance.Window, res model.ScanResult) (maintenance.Window, bool) {
+	addr, err := netip.ParseAddr(res.IP)
+	if err != nil {
+		return maintenance.Window{}, false
+	}
+	for _, w := range windows {
+		if w.Covers(addr) {
+			return w, true
+		}
+	}
+	return maintenance.Window{}, false
+}
+
+func coveringTarget(windows []maintenance.Window, t string) (maintenance.Window, bool) {
+	for _, w := range windows {
+		if w.CoversTarget(t) {
+			return w, true
+		}
+	}
+	return maintenance.Window{}, false
+}
+
+// inherit copies the last runs of the runner this one replaces on reload.
+func (r *runner) inherit(old *runner) {
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, run := range old.lastRuns {
+		r.lastRuns[name] = run
+	}
+}
+
+// LastRuns returns the last run of every job in configuration order;
+// jobs that have not run yet have a zero StartedAt.
+func (r *runner) LastRuns() []model.RunSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	runs := make([]model.RunSummary, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		run, ok := r.lastRuns[j.cfg.Name]
+		if !ok {
+			run.Job = j.cfg.Name
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Last returns the most recent run of any job.
+func (r *runner) Last() model.RunSummary {
+	var last model.RunSummary
+	for _, run := range r.LastRuns() {
+		if run.StartedAt.After(last.StartedAt) {
+			last = run
+		}
+	}
+	return last
+}
+
+// trackNames saves the addresses of the job's hostnames and sends a notice
+// when they differ from the previous run.
+func (r *runner) trackNames(ctx context.Context, j *job, names map[string][]netip.Addr) {
+	hosts := slices.Sorted(maps.Keys(names))
+
+	var changes []string
+	for _, h := range hosts {
+		addrs := make([]string, len(names[h]))
+		for i, a := range names[h] {
+			addrs[i] = a.String()
+		}
+
+		prev, ok, err := r.storage.HostAddrs(h)
+		if err != nil {
+			j.log.Errorf("Load addresses of %s failed: %v", h, err)
+			continue
+		}
+		if ok && slices.Equal(prev, addrs) {
+			continue
+		}
+		if ok {
+			changes = append(changes, fmt.Sprintf("%s now resolves to %s (was %s)",
+				h, strings.Join(addrs, ", "), strings.Join(prev, ", ")))
+		}
+		if err := r.storage.SaveHostAddrs(h, addrs); err != nil {
+			j.log.Errorf("Save addresses of %s failed: %v", h, err)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	text := strings.Join(changes, "\n")
+	j.log.Warnf("Hostname addresses changed: %s", text)
+	notify := r.dnsNotify
+	if len(j.cfg.Notify) > 0 {
+		notify = j.cfg.Notify
+	}
+	r.ds.SendNotice(ctx, notify, dnsTitle, jobText(j.cfg.Name, text))
+}
+
+// nameResults sets the hostname each result's address was resolved from;
+// an address of several names gets the first in order.
+func nameResults(results []model.ScanResult, names map[string][]netip.Addr) {
+	if len(names) == 0 {
+		return
+	}
+
+	byAddr := make(map[netip.Addr]string)
+	for _, h := range slices.Sorted(maps.Keys(names)) {
+		for _, a := range names[h] {
+			if _, ok := byAddr[a]; !ok {
+				byAddr[a] = h
+			}
+		}
+	}
+
+	for i, res := range results {
+		if addr, err := netip.ParseAddr(res.IP); err == nil {
+			results[i].Hostname = byAddr[addr.Unmap()]
+		}
+	}
+}
+
+// jobText prefixes a health message with the job name.
+func jobText(name, text string) string {
+	if name == config.DefaultJobName {
+		return text
+	}
+	return fmt.Sprintf("Job %s: %s", name, text)
+}
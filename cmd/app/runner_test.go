@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/notifier"
+	"github.com/Qwental/port-scanner-alert-system/internal/outbox"
+	"github.com/Qwental/port-scanner-alert-system/internal/storage/sqlite"
+	"github.com/Qwental/port-scanner-alert-system/internal/target"
+)
+
+type fakeSender struct {
+	sent []notifier.Message
+}
+
+func (f *fakeSender) Deliver(payload []byte, _ string) error {
+	var m notifier.Message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return err
+	}
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func newTestStorage(t *testing.T) *sqlite.Storage {
+	t.Helper()
+	storage, err := sqlite.NewStorage(filepath.Join(t.TempDir(), "scanner.db"), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(storage.Close)
+	return storage
+}
+
+func resolveNames(t *testing.T, r target.StaticResolver, entries ...string) map[string][]netip.Addr {
+	t.Helper()
+	l, _, err := target.ParseList(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, names, err := l.Resolve(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestNameResults(t *testing.T) {
+	names := resolveNames(t, target.StaticResolver{
+		"web02.corp": {netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("2001:db8::1")},
+		"web01.corp": {netip.MustParseAddr("::ffff:10.0.0.1")},
+	}, "web02.corp", "web01.corp")
+
+	results := []model.ScanResult{
+		{IP: "10.0.0.1", Port: 80},
+		{IP: "::ffff:10.0.0.1", Port: 443},
+		{IP: "2001:db8::1", Port: 22},
+		{IP: "10.0.0.2", Port: 80},
+	}
+	nameResults(results, names)
+
+	want := []string{"web01.corp", "web01.corp", "web02.corp", ""}
+	for i, res := range results {
+		if res.Hostname != want[i] {
+			t.Errorf("%s: hostname = %q, want %q", res.IP, res.Hostname, want[i])
+		}
+	}
+
+	plain := []model.ScanResult{{IP: "10.0.0.1", Port: 80}}
+	nameResults(plain, nil)
+	if plain[0].Hostname != "" {
+		t.Errorf("hostname without names = %q", plain[0].Hostname)
+	}
+}
+
+func TestTrackNames(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	storage := newTestStorage(t)
+
+	sender := &fakeSender{}
+	ob := outbox.New(storage, outbox.Options{}, log)
+	ob.Register("email", sender)
+
+	r := &runner{
+		storage:   storage,
+		ds:        &dispatcher{channels: []alertChannel{{name: "email"}}, ob: ob, log: log},
+		dnsNotify: []string{"email"},
+		log:       log,
+	}
+	j := &job{cfg: config.JobConfig{Name: "dmz"}, log: log}
+	ctx := context.Background()
+
+	resolver := target.StaticResolver{
+		"web01.corp": {netip.MustParseAddr("10.0.0.1")},
+		"db.corp":    {netip.MustParseAddr("10.0.0.5")},
+	}
+	r.trackNames(ctx, j, resolveNames(t, resolver, "web01.corp", "db.corp"))
+	if len(sender.sent) != 0 {
+		t.Fatalf("first resolution sent %d notices", len(sender.sent))
+	}
+
+	r.trackNames(ctx, j, resolveNames(t, resolver, "web01.corp", "db.corp"))
+	if len(sender.sent) != 0 {
+		t.Fatalf("unchanged addresses sent %d notices", len(sender.sent))
+	}
+
+	resolver["web01.corp"] = []netip.Addr{netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("2001:db8::1")}
+	r.trackNames(ctx, j, resolveNames(t, resolver, "web01.corp", "db.corp"))
+	if len(sender.sent) != 1 {
+		t.Fatalf("changed address sent %d notices, want 1", len(sender.sent))
+	}
+	m := sender.sent[0]
+	if m.Subject != dnsTitle {
+		t.Errorf("subject = %q, want %q", m.Subject, dnsTitle)
+	}
+	if want := "web01.corp now resolves to 10.0.0.2, 2001:db8::1 (was 10.0.0.1)"; !strings.Contains(m.Text, want) {
+		t.Errorf("text = %q, want it to contain %q", m.Text, want)
+	}
+	if strings.Contains(m.Text, "db.corp") {
+		t.Errorf("text = %q mentions an unchanged name", m.Text)
+	}
+
+	addrs, ok, err := storage.HostAddrs("web01.corp")
+	if err != nil || !ok || strings.Join(addrs, ",") != "10.0.0.2,2001:db8::1" {
+		t.Errorf("stored addresses = %v %v %v", addrs, ok, err)
+	}
+}
@@ -1,42 +1,328 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	ProjectName string          `yaml:"project_name"`
-	Masscan     MasscanConfig   `yaml:"masscan"`
-	Targets     []string        `yaml:"targets"`
+	ProjectName string        `yaml:"project_name"`
+	Masscan     MasscanConfig `yaml:"masscan"`
+	// PortProfiles are named port lists used in ports as "profile:<name>",
+	// in addition to the built-in ones; see portset.Profiles.
+	PortProfiles map[string]PortList `yaml:"port_profiles"`
+	Targets      []string            `yaml:"targets"`
+	// TargetsFile adds targets from a file, one per line, "#" comments.
+	TargetsFile string `yaml:"targets_file"`
+	// Exclude and ExcludeFile are never scanned by any job.
+	Exclude     []string        `yaml:"exclude"`
+	ExcludeFile string          `yaml:"exclude_file"`
 	Database    DatabaseConfig  `yaml:"database"`
 	Scheduler   SchedulerConfig `yaml:"scheduler"`
 	Telegram    TelegramConfig  `yaml:"telegram"`
 	SMTP        SMTPConfig      `yaml:"smtp"`
+	Outbox      OutboxConfig    `yaml:"outbox"`
+	// TargetGroups maps a group name to IPs and CIDRs, used by routing rules.
+	TargetGroups map[string][]string `yaml:"target_groups"`
+	Severity     SeverityConfig      `yaml:"severity"`
+	// Notifiers are additional named telegram/email instances;
+	// the top-level telegram and smtp sections are named "telegram" and "email".
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+	Routing   RoutingConfig    `yaml:"routing"`
+	Health    HealthConfig     `yaml:"health"`
+	Heartbeat HeartbeatConfig  `yaml:"heartbeat"`
+	Control   ControlConfig    `yaml:"control"`
+	Reload    ReloadConfig     `yaml:"reload"`
+	// Jobs replace the top-level targets/masscan/scheduler with several
+	// independent scans; see EffectiveJobs.
+	Jobs        []JobConfig         `yaml:"jobs"`
+	Maintenance []MaintenanceConfig `yaml:"maintenance"`
+}
+
+// MaintenanceConfig is a blackout window. A recurring window starts on Cron
+// and lasts Duration; a one-off window runs From-To ("2006-01-02 15:04").
+// Times use Timezone (local time if empty). Groups limit the window to target
+// groups, all targets if empty. Action is skip (no scans) or suppress (scan,
+// but hold notifications and send a summary when the window ends).
+type MaintenanceConfig struct {
+	Name     string   `yaml:"name"`
+	Cron     string   `yaml:"cron"`
+	Duration string   `yaml:"duration"`
+	From     string   `yaml:"from"`
+	To       string   `yaml:"to"`
+	Timezone string   `yaml:"timezone"`
+	Groups   []string `yaml:"groups"`
+	Action   string   `yaml:"action"`
+}
+
+// JobConfig is a named scan with its own targets, masscan settings and
+// schedule. Empty masscan fields and an empty schedule are inherited from
+// the top level; the port lists only if the job sets neither. Notify, if set, sends the job's changes to these notifiers
+// instead of applying routing rules.
+type JobConfig struct {
+	Name        string   `yaml:"name"`
+	Targets     []string `yaml:"targets"`
+	TargetsFile string   `yaml:"targets_file"`
+	// Exclude and ExcludeFile add to the top-level exclusions.
+	Exclude     []string        `yaml:"exclude"`
+	ExcludeFile string          `yaml:"exclude_file"`
+	Masscan     MasscanConfig   `yaml:"masscan"`
+	Scheduler   SchedulerConfig `yaml:"scheduler"`
+	Notify      []string        `yaml:"notify"`
+}
+
+// DefaultJobName is the name of the implicit job built from the top-level
+// targets when no jobs are configured.
+const DefaultJobName = "default"
+
+// EffectiveJobs returns the configured jobs with inherited settings filled in,
+// or a single job built from the top-level sections.
+func (c *Config) EffectiveJobs() []JobConfig {
+	if len(c.Jobs) == 0 {
+		return []JobConfig{{
+			Name:        DefaultJobName,
+			Targets:     c.Targets,
+			TargetsFile: c.TargetsFile,
+			Masscan:     c.Masscan,
+			Scheduler:   c.Scheduler,
+		}}
+	}
+
+	jobs := make([]JobConfig, len(c.Jobs))
+	for i, j := range c.Jobs {
+		if j.Masscan.Rate == "" {
+			j.Masscan.Rate = c.Masscan.Rate
+		}
+		if j.Masscan.Interface == "" {
+			j.Masscan.Interface = c.Masscan.Interface
+		}
+		// a job with its own TCP or UDP list scans only what it lists
+		if j.Masscan.Ports == "" && j.Masscan.UDPPorts == "" {
+			j.Masscan.Ports = c.Masscan.Ports
+			j.Masscan.UDPPorts = c.Masscan.UDPPorts
+		}
+		if j.Scheduler.Interval == "" && j.Scheduler.Cron == "" {
+			j.Scheduler = c.Scheduler
+		}
+		if j.Scheduler.Overlap == "" {
+			j.Scheduler.Overlap = c.Scheduler.Overlap
+		}
+		if j.Scheduler.Jitter == "" {
+			j.Scheduler.Jitter = c.Scheduler.Jitter
+		}
+		j.Scheduler.Enabled = c.Scheduler.Enabled
+		jobs[i] = j
+	}
+	return jobs
+}
+
+// ControlConfig enables the local control interface in scheduler mode.
+// Listen is a unix socket ("unix:/run/port-scanner.sock") or a loopback TCP
+// address ("127.0.0.1:9090"), since requests are not authenticated; empty
+// disables it.
+type ControlConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// ReloadConfig enables polling the config file for changes in scheduler
+// mode, in addition to reloading on SIGHUP. Interval defaults to 10s.
+type ReloadConfig struct {
+	Watch    bool   `yaml:"watch"`
+	Interval string `yaml:"interval"`
+}
+
+// HeartbeatConfig sends periodic "still alive" messages in scheduler mode
+// (Interval, empty disables) and pings PingURL after every run.
+type HeartbeatConfig struct {
+	Interval string   `yaml:"interval"`
+	Notify   []string `yaml:"notify"`
+	PingURL  string   `yaml:"ping_url" secret:"true"`
+}
+
+// HealthConfig enables alerts about the scanner itself. Notify lists notifier
+// names (all top-level notifiers if empty).
+type HealthConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	Notify           []string `yaml:"notify"`
+	AlertOnError     bool     `yaml:"alert_on_error"`
+	FailureThreshold int      `yaml:"failure_threshold"`
+	DropPercent      float64  `yaml:"drop_percent"`
+	MinPrevious      int      `yaml:"min_previous"`
 }
 
+type SeverityConfig struct {
+	CriticalPorts string `yaml:"critical_ports"`
+	HighPorts     string `yaml:"high_ports"`
+}
+
+// NotifierConfig describes an extra notifier. Telegram instances reuse the bot
+// token, email instances reuse the SMTP server settings and override recipients.
+type NotifierConfig struct {
+	Name   string      `yaml:"name"`
+	Type   string      `yaml:"type"`
+	ChatID int64       `yaml:"chat_id"`
+	To     AddressList `yaml:"to"`
+	Cc     AddressList `yaml:"cc"`
+	Bcc    AddressList `yaml:"bcc"`
+
+	Delivery  DeliveryConfig  `yaml:"delivery"`
+	Templates TemplatesConfig `yaml:"templates"`
+}
+
+// RoutingConfig selects notifiers per change. A change goes to the notifiers
+// of every matching rule; changes matching no rule go to Default
+// (all top-level notifiers if empty).
+type RoutingConfig struct {
+	Default []string    `yaml:"default"`
+	Rules   []RouteRule `yaml:"rules"`
+}
+
+// RouteRule matches a change if all of its non-empty conditions match.
+type RouteRule struct {
+	Name        string   `yaml:"name"`
+	CIDRs       []string `yaml:"cidrs"`
+	Groups      []string `yaml:"groups"`
+	Ports       string   `yaml:"ports"`
+	Changes     []string `yaml:"changes"`
+	MinSeverity string   `yaml:"min_severity"`
+	Notify      []string `yaml:"notify"`
+}
+
+// MasscanConfig holds scanner settings. Ports are TCP ports and UDPPorts
+// UDP ports, both in masscan syntax ("53,161-162") with port profiles;
+// at least one is needed. LoadConfig expands the profiles.
 type MasscanConfig struct {
-	Rate      string `yaml:"rate"`
-	Interface string `yaml:"interface"`
-	Ports     string `yaml:"ports"`
+	Rate      string   `yaml:"rate"`
+	Interface string   `yaml:"interface"`
+	Ports     PortList `yaml:"ports"`
+	UDPPorts  PortList `yaml:"udp_ports"`
+}
+
+// PortList is a comma-separated list of ports, ranges and "profile:<name>"
+// references. In YAML it may also be a list: [profile:web, 8080-8090].
+type PortList string
+
+func (p *PortList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.SequenceNode {
+		var s string
+		if err := n.Decode(&s); err != nil {
+			return err
+		}
+		*p = PortList(s)
+		return nil
+	}
+
+	parts := make([]string, len(n.Content))
+	for i, c := range n.Content {
+		if c.Kind != yaml.ScalarNode {
+			return &yaml.TypeError{Errors: []string{
+				fmt.Sprintf("line %d: expected a port, range or profile", c.Line),
+			}}
+		}
+		parts[i] = c.Value
+	}
+	*p = PortList(strings.Join(parts, ","))
+	return nil
+}
+
+// expandPorts replaces port profiles with the ports they stand for.
+// The lists are validated already.
+func (c *Config) expandPorts() {
+	expand := func(p *PortList) {
+		if *p == "" {
+			return
+		}
+		if set, err := c.ExpandPorts(*p); err == nil {
+			*p = PortList(set.String())
+		}
+	}
+
+	expand(&c.Masscan.Ports)
+	expand(&c.Masscan.UDPPorts)
+	for i := range c.Jobs {
+		expand(&c.Jobs[i].Masscan.Ports)
+		expand(&c.Jobs[i].Masscan.UDPPorts)
+	}
+}
+
+// ExpandPorts parses a port list with the built-in and configured profiles.
+func (c *Config) ExpandPorts(p PortList) (portset.Set, error) {
+	user := make(map[string]string, len(c.PortProfiles))
+	for name, ports := range c.PortProfiles {
+		user[name] = string(ports)
+	}
+	return portset.Expand(string(p), user)
 }
 
 type DatabaseConfig struct {
 	Path string `yaml:"path"`
 }
 
+// SchedulerConfig runs scans every Interval or on a Cron expression
+// (evaluated in Timezone, local time if empty); Cron takes precedence.
 type SchedulerConfig struct {
-	Enabled  bool   `yaml:"enabled"`
-	Interval string `yaml:"interval"`
+	Enabled      bool   `yaml:"enabled"`
+	Interval     string `yaml:"interval"`
+	Cron         string `yaml:"cron"`
+	Timezone     string `yaml:"timezone"`
+	SkipFirstRun bool   `yaml:"skip_first_run"`
+	// Overlap is what happens when a run is due while the previous one is
+	// still going: skip (default), queue or cancel.
+	Overlap string `yaml:"overlap"`
+	// Jitter delays every scheduled run by a random duration up to this value.
+	Jitter string `yaml:"jitter"`
+}
+
+// OutboxConfig controls notification retries. Durations use time.ParseDuration
+// format; empty values fall back to defaults.
+type OutboxConfig struct {
+	MaxAttempts   int    `yaml:"max_attempts"`
+	BaseDelay     string `yaml:"base_delay"`
+	MaxDelay      string `yaml:"max_delay"`
+	RetryInterval string `yaml:"retry_interval"`
+}
+
+// DeliveryConfig controls when a notifier sends changes:
+// "immediate" (default), "batch" every Every, or a daily "digest" at At (HH:MM).
+// During QuietHours ("22:00-07:00") changes are held back unless their
+// severity reaches BypassSeverity (default "critical", "none" disables).
+type DeliveryConfig struct {
+	Mode           string `yaml:"mode"`
+	Every          string `yaml:"every"`
+	At             string `yaml:"at"`
+	Timezone       string `yaml:"timezone"`
+	QuietHours     string `yaml:"quiet_hours"`
+	BypassSeverity string `yaml:"bypass_severity"`
+}
+
+// TemplatesConfig points to user templates; empty fields use built-in rendering.
+// Subject is an inline text/template, Text and HTML are paths to
+// text/template and html/template files. Telegram uses HTML (Telegram's tag
+// subset) and falls back to the escaped Text template.
+type TemplatesConfig struct {
+	Subject string `yaml:"subject"`
+	Text    string `yaml:"text"`
+	HTML    string `yaml:"html"`
 }
 
 type TelegramConfig struct {
 	Enabled bool   `yaml:"enabled"`
-	Token   string `yaml:"token"`   
+	Token   string `yaml:"token" secret:"true"`
 	ChatID  int64  `yaml:"chat_id"`
+	// Bot enables long-polling for commands and ack buttons.
+	Bot            bool            `yaml:"bot"`
+	AllowedChatIDs []int64         `yaml:"allowed_chat_ids"`
+	Delivery       DeliveryConfig  `yaml:"delivery"`
+	Templates      TemplatesConfig `yaml:"templates"`
 }
 
 type SMTPConfig struct {
@@ -44,63 +330,191 @@ type SMTPConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
 	From     string `yaml:"from"`
-	To       string `yaml:"to"`
+	// TLS is one of "none", "starttls" (default) or "tls" (implicit, port 465).
+	TLS string      `yaml:"tls"`
+	To  AddressList `yaml:"to"`
+	Cc  AddressList `yaml:"cc"`
+	Bcc AddressList `yaml:"bcc"`
+	// Attachments adds the full diff and scan report as CSV and JSON files
+	// to emails with more than MaxBodyChanges changes.
+	Attachments bool `yaml:"attachments"`
+	// MaxBodyChanges limits the changes listed in the body when attachments
+	// are enabled; 0 means no limit, with the files attached to every email.
+	MaxBodyChanges int             `yaml:"max_body_changes"`
+	Delivery       DeliveryConfig  `yaml:"delivery"`
+	Templates      TemplatesConfig `yaml:"templates"`
 }
 
-func LoadConfig(configPath string) (*Config, error) {
+// AddressList accepts either a YAML list or a comma-separated string.
+type AddressList []string
+
+func (l *AddressList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = splitList(value.Value)
+		return nil
+	}
+
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// LoadConfig reads the config file, applies overrides and validates the
+// result. Precedence is defaults < file < environment (legacy variables
+// such as TELEGRAM_TOKEN, then PSAS_*) < sets ("path=value" from the command
+// line). Unknown keys are rejected. All problems are reported at once as a
+// *ValidationError with file line references.
+func LoadConfig(configPath string, sets ...string) (*Config, error) {
 	config := &Config{}
 
-	file, err := os.Open(configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	d := yaml.NewDecoder(file)
-	if err := d.Decode(&config); err != nil {
-		return nil, err
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", configPath, err)
 	}
-
+	v := newValidator(&root)
 
 	_ = godotenv.Load()
 
-	if token := os.Getenv("TELEGRAM_TOKEN"); token != "" {
+	// Unknown keys are checked on the file as written; values are decoded
+	// after ${scheme:arg} references are resolved, so type errors on
+	// referencing lines come from the resolved text.
+	refLines := make(map[int]bool)
+	resolveRefs(&root, v, refLines)
+
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	if err := d.Decode(&config); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+		for _, p := range typeErrorProblems(typeErr) {
+			if !refLines[p.Line] {
+				v.problems = append(v.problems, p)
+			}
+		}
+	}
+
+	if len(refLines) > 0 {
+		config = &Config{}
+		if err := root.Decode(config); err != nil {
+			var typeErr *yaml.TypeError
+			if !errors.As(err, &typeErr) {
+				return nil, fmt.Errorf("%s: %w", configPath, err)
+			}
+			for _, p := range typeErrorProblems(typeErr) {
+				if refLines[p.Line] {
+					v.problems = append(v.problems, p)
+				}
+			}
+		}
+	}
+
+	if token := v.getenv("TELEGRAM_TOKEN"); token != "" {
 		config.Telegram.Token = token
+		v.origin["telegram.token"] = "$TELEGRAM_TOKEN"
 	}
 
-	if chatIDStr := os.Getenv("TELEGRAM_CHAT_ID"); chatIDStr != "" {
+	if chatIDStr := v.getenv("TELEGRAM_CHAT_ID"); chatIDStr != "" {
 		if chatID, err := strconv.ParseInt(chatIDStr, 10, 64); err == nil {
 			config.Telegram.ChatID = chatID
+			v.origin["telegram.chat_id"] = "$TELEGRAM_CHAT_ID"
+		} else {
+			v.addEnv("TELEGRAM_CHAT_ID", "invalid chat id %q", chatIDStr)
 		}
 	}
 
-	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+	if smtpHost := v.getenv("SMTP_HOST"); smtpHost != "" {
 		config.SMTP.Host = smtpHost
+		v.origin["smtp.host"] = "$SMTP_HOST"
 	}
 
-	if smtpPortStr := os.Getenv("SMTP_PORT"); smtpPortStr != "" {
+	if smtpPortStr := v.getenv("SMTP_PORT"); smtpPortStr != "" {
 		if port, err := strconv.Atoi(smtpPortStr); err == nil {
 			config.SMTP.Port = port
+			v.origin["smtp.port"] = "$SMTP_PORT"
+		} else {
+			v.addEnv("SMTP_PORT", "invalid port %q", smtpPortStr)
 		}
 	}
 
-	if smtpUser := os.Getenv("SMTP_USER"); smtpUser != "" {
+	if smtpUser := v.getenv("SMTP_USER"); smtpUser != "" {
 		config.SMTP.User = smtpUser
+		v.origin["smtp.user"] = "$SMTP_USER"
 	}
 
-	if smtpPass := os.Getenv("SMTP_PASSWORD"); smtpPass != "" {
+	if smtpPass := v.getenv("SMTP_PASSWORD"); smtpPass != "" {
 		config.SMTP.Password = smtpPass
+		v.origin["smtp.password"] = "$SMTP_PASSWORD"
+	}
+
+	if smtpTo := v.getenv("SMTP_TO"); smtpTo != "" {
+		config.SMTP.To = splitList(smtpTo)
+		v.origin["smtp.to"] = "$SMTP_TO"
 	}
 
-	if smtpTo := os.Getenv("SMTP_TO"); smtpTo != "" {
-    config.SMTP.To = smtpTo
+	if smtpCc := v.getenv("SMTP_CC"); smtpCc != "" {
+		config.SMTP.Cc = splitList(smtpCc)
+		v.origin["smtp.cc"] = "$SMTP_CC"
 	}
-	
-	if smtpFrom := os.Getenv("SMTP_FROM"); smtpFrom != "" {
+
+	if smtpBcc := v.getenv("SMTP_BCC"); smtpBcc != "" {
+		config.SMTP.Bcc = splitList(smtpBcc)
+		v.origin["smtp.bcc"] = "$SMTP_BCC"
+	}
+
+	if smtpTLS := v.getenv("SMTP_TLS"); smtpTLS != "" {
+		config.SMTP.TLS = smtpTLS
+		v.origin["smtp.tls"] = "$SMTP_TLS"
+	}
+
+	if smtpFrom := v.getenv("SMTP_FROM"); smtpFrom != "" {
 		config.SMTP.From = smtpFrom
+		v.origin["smtp.from"] = "$SMTP_FROM"
+	}
+
+	if pingURL := v.getenv("HEARTBEAT_PING_URL"); pingURL != "" {
+		config.Heartbeat.PingURL = pingURL
+		v.origin["heartbeat.ping_url"] = "$HEARTBEAT_PING_URL"
+	}
+
+	config.applyEnv(v)
+	config.applySets(sets, v)
+
+	config.validate(v)
+	if len(v.problems) == 0 {
+		config.expandPorts()
+	}
+	if len(v.problems) > 0 {
+		// file order, environment problems last
+		slices.SortStableFunc(v.problems, func(a, b Problem) int {
+			if a.Line == 0 || b.Line == 0 {
+				return b.Line - a.Line
+			}
+			return a.Line - b.Line
+		})
+		return nil, &ValidationError{File: configPath, Problems: v.problems}
 	}
 
 	return config, nil
-}
\ No newline at end of file
+}
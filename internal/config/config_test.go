@@ -0,0 +1,111 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEffectiveJobs(t *testing.T) {
+	c := &Config{
+		Masscan: MasscanConfig{Rate: "1000", Interface: "eth0", Ports: "22,80,443", UDPPorts: "53,161"},
+		Scheduler: SchedulerConfig{
+			Enabled: true, Interval: "30m", Overlap: "queue", Jitter: "1m",
+		},
+		Jobs: []JobConfig{
+			{Name: "inherit"},
+			{Name: "tcp", Masscan: MasscanConfig{Ports: "3389"}},
+			{Name: "udp", Masscan: MasscanConfig{UDPPorts: "1900,5353"}},
+			{Name: "both", Masscan: MasscanConfig{Ports: "8080", UDPPorts: "123", Rate: "50"}},
+			{Name: "cron", Scheduler: SchedulerConfig{Cron: "0 3 * * *"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		tcp, udp PortList
+		rate     string
+		interval string
+		cron     string
+		overlap  string
+		iface    string
+	}{
+		{"inherit", "22,80,443", "53,161", "1000", "30m", "", "queue", "eth0"},
+		{"tcp", "3389", "", "1000", "30m", "", "queue", "eth0"},
+		{"udp", "", "1900,5353", "1000", "30m", "", "queue", "eth0"},
+		{"both", "8080", "123", "50", "30m", "", "queue", "eth0"},
+		{"cron", "22,80,443", "53,161", "1000", "", "0 3 * * *", "queue", "eth0"},
+	}
+
+	jobs := c.EffectiveJobs()
+	if len(jobs) != len(tests) {
+		t.Fatalf("EffectiveJobs returned %d jobs, want %d", len(jobs), len(tests))
+	}
+	for i, tt := range tests {
+		j := jobs[i]
+		if j.Name != tt.name {
+			t.Fatalf("job %d is %q, want %q", i, j.Name, tt.name)
+		}
+		if j.Masscan.Ports != tt.tcp || j.Masscan.UDPPorts != tt.udp {
+			t.Errorf("%s: ports %q udp_ports %q, want %q %q", tt.name, j.Masscan.Ports, j.Masscan.UDPPorts, tt.tcp, tt.udp)
+		}
+		if j.Masscan.Rate != tt.rate || j.Masscan.Interface != tt.iface {
+			t.Errorf("%s: rate %q interface %q, want %q %q", tt.name, j.Masscan.Rate, j.Masscan.Interface, tt.rate, tt.iface)
+		}
+		if j.Scheduler.Interval != tt.interval || j.Scheduler.Cron != tt.cron {
+			t.Errorf("%s: interval %q cron %q, want %q %q", tt.name, j.Scheduler.Interval, j.Scheduler.Cron, tt.interval, tt.cron)
+		}
+		if j.Scheduler.Overlap != tt.overlap || j.Scheduler.Jitter != "1m" || !j.Scheduler.Enabled {
+			t.Errorf("%s: scheduler %+v does not inherit the top-level policy", tt.name, j.Scheduler)
+		}
+	}
+}
+
+func TestEffectiveJobsDefault(t *testing.T) {
+	c := &Config{
+		Targets: []string{"10.0.0.0/24"},
+		Masscan: MasscanConfig{UDPPorts: "53"},
+	}
+	jobs := c.EffectiveJobs()
+	if len(jobs) != 1 || jobs[0].Name != DefaultJobName {
+		t.Fatalf("EffectiveJobs = %+v, want the default job", jobs)
+	}
+	if jobs[0].Masscan.Ports != "" || jobs[0].Masscan.UDPPorts != "53" || len(jobs[0].Targets) != 1 {
+		t.Errorf("default job = %+v", jobs[0])
+	}
+}
+
+func TestValidateControlListen(t *testing.T) {
+	tests := []struct {
+		listen string
+		err    string
+	}{
+		{"", ""},
+		{"unix:/run/port-scanner.sock", ""},
+		{"127.0.0.1:9090", ""},
+		{"127.0.0.2:9090", ""},
+		{"[::1]:9090", ""},
+		{"localhost:9090", ""},
+		{"unix:", "socket path is empty"},
+		{"0.0.0.0:8080", "not a loopback address"},
+		{":8080", "not a loopback address"},
+		{"[::]:8080", "not a loopback address"},
+		{"10.0.0.5:8080", "not a loopback address"},
+		{"scanner.corp:8080", "not a loopback address"},
+		{"127.0.0.1", "invalid address"},
+		{"127.0.0.1:http", "invalid port"},
+		{"127.0.0.1:70000", "invalid port"},
+	}
+	for _, tt := range tests {
+		v := newValidator(nil)
+		v.control("control.listen", tt.listen)
+
+		var msgs []string
+		for _, p := range v.problems {
+			msgs = append(msgs, p.Msg)
+		}
+		got := strings.Join(msgs, "; ")
+		if tt.err == "" && got != "" || !strings.Contains(got, tt.err) {
+			t.Errorf("control.listen %q: problems %q, want %q", tt.listen, got, tt.err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variable of every scalar or list setting:
+// the yaml key path in upper case joined by "_", e.g. PSAS_MASSCAN_RATE for
+// masscan.rate. Lists are comma-separated. Lists of sections (jobs,
+// notifiers, routing rules, maintenance) and target_groups can only be set in
+// the file.
+const EnvPrefix = "PSAS_"
+
+const secretMask = "******"
+
+// setting is a config value reachable by a yaml key path.
+type setting struct {
+	path   string
+	value  reflect.Value
+	secret bool
+}
+
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_").Replace(s.path))
+}
+
+// settings lists every setting of c that can be overridden, in field order.
+func (c *Config) settings() []setting {
+	var out []setting
+	collectSettings(reflect.ValueOf(c).Elem(), "", &out)
+	return out
+}
+
+func collectSettings(v reflect.Value, prefix string, out *[]setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			collectSettings(fv, path, out)
+		case settable(fv.Type()):
+			*out = append(*out, setting{path: path, value: fv, secret: f.Tag.Get("secret") == "true"})
+		}
+	}
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.String, reflect.Int, reflect.Int64:
+			return true
+		}
+	}
+	return false
+}
+
+// set parses s into the setting according to its type.
+func (s setting) set(raw string) error {
+	v := s.value
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := splitList(raw)
+		list := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if v.Type().Elem().Kind() == reflect.String {
+				list.Index(i).SetString(p)
+				continue
+			}
+			n, err := strconv.ParseInt(p, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid integer %q in list", p)
+			}
+			list.Index(i).SetInt(n)
+		}
+		v.Set(list)
+	}
+	return nil
+}
+
+// applyEnv applies PSAS_* variables, or their _FILE and systemd credential
+// forms, and records where values came from.
+func (c *Config) applyEnv(v *validator) {
+	for _, s := range c.settings() {
+		raw, ok, err := lookupEnv(s.env())
+		if err != nil {
+			v.addEnv(s.env(), "%v", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			v.addEnv(s.env(), "%v", err)
+			continue
+		}
+		v.origin[s.path] = "$" + s.env()
+	}
+}
+
+// applySets applies "path=value" overrides from the command line.
+func (c *Config) applySets(sets []string, v *validator) {
+	if len(sets) == 0 {
+		return
+	}
+
+	byPath := make(map[string]setting)
+	for _, s := range c.settings() {
+		byPath[s.path] = s
+	}
+
+	for _, kv := range sets {
+		path, raw, ok := strings.Cut(kv, "=")
+		path = strings.TrimSpace(path)
+		s, known := byPath[path]
+		switch {
+		case !ok:
+			v.problems = append(v.problems, Problem{Path: "-set " + kv, Msg: "expected path=value"})
+		case !known:
+			v.problems = append(v.problems, Problem{Path: "-set " + kv, Msg: fmt.Sprintf("unknown setting %q", path)})
+		default:
+			if err := s.set(raw); err != nil {
+				v.problems = append(v.problems, Problem{Path: "-set " + kv, Msg: err.Error()})
+				continue
+			}
+			v.origin[path] = "-set"
+		}
+	}
+}
+
+// EnvVars returns the PSAS_* variable of every overridable setting.
+func EnvVars() []string {
+	var c Config
+	var out []string
+	for _, s := range c.settings() {
+		out = append(out, s.env())
+	}
+	return out
+}
+
+// Print writes c as YAML with secrets masked.
+func (c *Config) Print(w io.Writer) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	var masked Config
+	if err := yaml.Unmarshal(data, &masked); err != nil {
+		return err
+	}
+	for _, s := range masked.settings() {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(secretMask)
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resolver returns the value of a reference such as ${file:/run/secrets/tg}
+// given its argument.
+type Resolver func(arg string) (string, error)
+
+var resolvers = map[string]Resolver{
+	"env":        resolveEnv,
+	"file":       readSecretFile,
+	"credential": readCredential,
+}
+
+// RegisterResolver adds a reference scheme usable in the config file as
+// ${scheme:arg}, e.g. for a secret manager.
+func RegisterResolver(scheme string, r Resolver) {
+	resolvers[scheme] = r
+}
+
+var refPattern = regexp.MustCompile(`\$\{([a-z][a-z0-9_-]*):([^}]*)\}`)
+
+// resolveRefs replaces ${scheme:arg} references in scalar values and records
+// their lines. A value that is a single reference gets its type from the
+// resolved text, so `chat_id: ${env:CHAT_ID}` decodes as a number.
+func resolveRefs(n *yaml.Node, v *validator, lines map[int]bool) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.MappingNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			resolveRefs(c, v, lines)
+		}
+		return
+	case yaml.ScalarNode:
+	default:
+		return
+	}
+
+	if !refPattern.MatchString(n.Value) {
+		return
+	}
+
+	lines[n.Line] = true
+	whole := refPattern.FindString(n.Value) == n.Value
+	n.Value = refPattern.ReplaceAllStringFunc(n.Value, func(ref string) string {
+		m := refPattern.FindStringSubmatch(ref)
+		resolve, ok := resolvers[m[1]]
+		if !ok {
+			v.problems = append(v.problems, Problem{Line: n.Line, Msg: fmt.Sprintf("unknown reference scheme %q in %s", m[1], ref)})
+			return ""
+		}
+		value, err := resolve(m[2])
+		if err != nil {
+			v.problems = append(v.problems, Problem{Line: n.Line, Msg: fmt.Sprintf("%s: %v", ref, err)})
+			return ""
+		}
+		return value
+	})
+	if whole {
+		n.Tag, n.Style = "", 0
+	}
+}
+
+func resolveEnv(name string) (string, error) {
+	value, ok, err := lookupEnv(name)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is not set", name)
+	}
+	return value, nil
+}
+
+// readSecretFile reads a secret, dropping the trailing newline most tools add.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readCredential reads a systemd credential (LoadCredential=, SetCredential=)
+// from $CREDENTIALS_DIRECTORY.
+func readCredential(name string) (string, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return "", errors.New("CREDENTIALS_DIRECTORY is not set")
+	}
+	if name == "" || strings.ContainsRune(name, '/') {
+		return "", fmt.Errorf("invalid credential name %q", name)
+	}
+	return readSecretFile(filepath.Join(dir, name))
+}
+
+// getenv returns the variable name as lookupEnv finds it, or "".
+func (v *validator) getenv(name string) string {
+	value, _, err := lookupEnv(name)
+	if err != nil {
+		v.addEnv(name, "%v", err)
+	}
+	return value
+}
+
+// lookupEnv returns the variable name, or else the contents of the file
+// named by name_FILE, or else the systemd credential with this name (as is
+// or lower-cased).
+func lookupEnv(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+
+	if path, ok := os.LookupEnv(name + "_FILE"); ok {
+		value, err := readSecretFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return value, true, nil
+	}
+
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		for _, cred := range []string{name, strings.ToLower(name)} {
+			value, err := readSecretFile(filepath.Join(dir, cred))
+			if err == nil {
+				return value, true, nil
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", false, fmt.Errorf("credential %s: %w", cred, err)
+			}
+		}
+	}
+
+	return "", false, nil
+}
@@ -0,0 +1,651 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
+	"github.com/Qwental/port-scanner-alert-system/internal/target"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a single config error. Line is 0 for values that come from the
+// environment or keys missing from the file.
+type Problem struct {
+	Line int
+	Path string
+	Msg  string
+}
+
+// ValidationError lists every problem found in a config file.
+type ValidationError struct {
+	File     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("%s: %d problem(s)", e.File, len(e.Problems)))
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.String(e.File))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (p Problem) String(file string) string {
+	loc := file
+	if p.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", file, p.Line)
+	}
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s", loc, p.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, p.Path, p.Msg)
+}
+
+// typeErrorLine matches yaml.v3 type errors such as
+// "line 5: field foo not found in type config.Config".
+var typeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+func typeErrorProblems(err *yaml.TypeError) []Problem {
+	out := make([]Problem, 0, len(err.Errors))
+	for _, e := range err.Errors {
+		p := Problem{Msg: e}
+		if m := typeErrorLine.FindStringSubmatch(e); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Msg = m[2]
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// validator collects problems. lines maps key paths such as
+// "jobs[1].masscan.ports" to their line in the file; origin maps paths set
+// from the environment or the command line to their source.
+type validator struct {
+	lines    map[string]int
+	origin   map[string]string
+	problems []Problem
+}
+
+func newValidator(root *yaml.Node) *validator {
+	v := &validator{lines: make(map[string]int), origin: make(map[string]string)}
+	if root != nil {
+		v.index(root, "")
+	}
+	return v
+}
+
+func (v *validator) index(n *yaml.Node, path string) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			v.index(c, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			p := key.Value
+			if path != "" {
+				p = path + "." + key.Value
+			}
+			v.lines[p] = key.Line
+			v.index(value, p)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			v.lines[p] = c.Line
+			v.index(c, p)
+		}
+	}
+}
+
+// line returns the line of path, or of its closest parent present in the file.
+func (v *validator) line(path string) int {
+	for path != "" {
+		if l, ok := v.lines[path]; ok {
+			return l
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			return 0
+		}
+		path = path[:i]
+	}
+	return 0
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	p := Problem{Path: path, Msg: fmt.Sprintf(format, args...)}
+	if src, ok := v.origin[strings.TrimRight(path, "[0123456789]")]; ok {
+		p.Path = fmt.Sprintf("%s (from %s)", path, src)
+	} else {
+		p.Line = v.line(path)
+	}
+	v.problems = append(v.problems, p)
+}
+
+func (v *validator) addEnv(name, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Path: "$" + name, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) duration(path, value string, positive bool) {
+	if value == "" {
+		return
+	}
+	d, err := time.ParseDuration(value)
+	switch {
+	case err != nil:
+		v.add(path, "invalid duration %q", value)
+	case positive && d <= 0:
+		v.add(path, "must be positive, got %q", value)
+	case d < 0:
+		v.add(path, "must not be negative, got %q", value)
+	}
+}
+
+func (v *validator) timezone(path, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		v.add(path, "unknown timezone %q", value)
+	}
+}
+
+func (v *validator) clock(path, value string) bool {
+	if _, err := time.Parse("15:04", strings.TrimSpace(value)); err != nil {
+		v.add(path, "invalid time of day %q, expected HH:MM", value)
+		return false
+	}
+	return true
+}
+
+func (v *validator) ports(path, value string) {
+	if _, err := portset.Parse(value); err != nil {
+		v.add(path, "%v", err)
+	}
+}
+
+func (v *validator) targets(path string, list []string) {
+	for i, t := range list {
+		if _, err := target.Parse(t); err != nil {
+			v.add(fmt.Sprintf("%s[%d]", path, i), "%v", err)
+		}
+	}
+}
+
+// entries checks a target or exclusion list, which may hold hostnames.
+// Targets to scan must not be too large.
+func (v *validator) entries(path string, list []string, scan bool) {
+	for i, t := range list {
+		prefixes, _, err := target.ParseEntry(t)
+		if err == nil && scan {
+			err = target.CheckScannable(prefixes)
+		}
+		if err != nil {
+			v.add(fmt.Sprintf("%s[%d]", path, i), "%v", err)
+		}
+	}
+}
+
+// targetsFile checks a targets_file or exclude_file.
+func (v *validator) targetsFile(path, value string, scan bool) {
+	if value == "" {
+		return
+	}
+	entries, err := target.ReadFile(value)
+	if err == nil && scan {
+		var l target.List
+		if l, _, err = target.ParseList(entries); err == nil {
+			err = target.CheckScannable(l.Prefixes)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", value, err)
+		}
+	}
+	if err != nil {
+		v.add(path, "%v", err)
+	}
+}
+
+func (v *validator) notify(path string, list []string, known map[string]bool) {
+	for i, n := range list {
+		if !known[n] {
+			v.add(fmt.Sprintf("%s[%d]", path, i), "unknown notifier %q", n)
+		}
+	}
+}
+
+func (v *validator) addresses(path string, list []string) {
+	for i, a := range list {
+		if _, err := mail.ParseAddress(a); err != nil {
+			v.add(fmt.Sprintf("%s[%d]", path, i), "invalid address %q", a)
+		}
+	}
+}
+
+func (v *validator) file(path, value string) {
+	if value == "" {
+		return
+	}
+	if _, err := os.Stat(value); err != nil {
+		v.add(path, "%v", err)
+	}
+}
+
+// validate checks the semantics of every section.
+func (c *Config) validate(v *validator) {
+	if len(c.Jobs) == 0 {
+		if len(c.Targets) == 0 && c.TargetsFile == "" {
+			v.add("targets", "no targets configured")
+		}
+		v.entries("targets", c.Targets, true)
+		v.targetsFile("targets_file", c.TargetsFile, true)
+	}
+	v.entries("exclude", c.Exclude, false)
+	v.targetsFile("exclude_file", c.ExcludeFile, false)
+	v.masscan("masscan", c.Masscan, len(c.Jobs) == 0, c)
+	for _, name := range slices.Sorted(maps.Keys(c.PortProfiles)) {
+		path := "port_profiles." + name
+		if strings.ContainsAny(name, ", \t") {
+			v.add(path, "invalid profile name %q", name)
+		}
+		if set, err := c.ExpandPorts(c.PortProfiles[name]); err != nil {
+			v.add(path, "%v", err)
+		} else if len(set) == 0 {
+			v.add(path, "no ports in profile %q", name)
+		}
+	}
+
+	if c.Database.Path == "" {
+		v.add("database.path", "is empty")
+	}
+
+	v.scheduler("scheduler", c.Scheduler, len(c.Jobs) == 0)
+
+	known := make(map[string]bool)
+	if c.Telegram.Enabled {
+		known["telegram"] = true
+		if c.Telegram.Token == "" {
+			v.add("telegram.token", "is empty (set it or TELEGRAM_TOKEN)")
+		}
+		if c.Telegram.ChatID == 0 {
+			v.add("telegram.chat_id", "is empty (set it or TELEGRAM_CHAT_ID)")
+		}
+	}
+	v.delivery("telegram.delivery", c.Telegram.Delivery)
+	v.templates("telegram.templates", c.Telegram.Templates)
+
+	if c.SMTP.Enabled {
+		known["email"] = true
+		v.smtp("smtp", c.SMTP)
+	}
+	v.delivery("smtp.delivery", c.SMTP.Delivery)
+	v.templates("smtp.templates", c.SMTP.Templates)
+
+	if c.Outbox.MaxAttempts < 0 {
+		v.add("outbox.max_attempts", "must not be negative")
+	}
+	v.duration("outbox.base_delay", c.Outbox.BaseDelay, true)
+	v.duration("outbox.max_delay", c.Outbox.MaxDelay, true)
+	v.duration("outbox.retry_interval", c.Outbox.RetryInterval, true)
+
+	for name, members := range c.TargetGroups {
+		v.targets("target_groups."+name, members)
+	}
+
+	v.ports("severity.critical_ports", c.Severity.CriticalPorts)
+	v.ports("severity.high_ports", c.Severity.HighPorts)
+
+	for i, n := range c.Notifiers {
+		path := fmt.Sprintf("notifiers[%d]", i)
+		switch {
+		case n.Name == "":
+			v.add(path+".name", "is empty")
+		case known[n.Name] || n.Name == "telegram" || n.Name == "email":
+			v.add(path+".name", "duplicate notifier name %q", n.Name)
+		}
+		known[n.Name] = true
+
+		switch n.Type {
+		case "telegram":
+			if c.Telegram.Token == "" {
+				v.add(path+".type", "telegram notifiers need telegram.token")
+			}
+			if n.ChatID == 0 {
+				v.add(path+".chat_id", "is empty")
+			}
+		case "email":
+			if c.SMTP.Host == "" {
+				v.add(path+".type", "email notifiers need smtp.host")
+			}
+			if len(n.To)+len(n.Cc)+len(n.Bcc) == 0 {
+				v.add(path+".to", "no recipients")
+			}
+			v.addresses(path+".to", n.To)
+			v.addresses(path+".cc", n.Cc)
+			v.addresses(path+".bcc", n.Bcc)
+		default:
+			v.add(path+".type", "unknown notifier type %q, expected telegram or email", n.Type)
+		}
+		v.delivery(path+".delivery", n.Delivery)
+		v.templates(path+".templates", n.Templates)
+	}
+
+	v.notify("routing.default", c.Routing.Default, known)
+	for i, r := range c.Routing.Rules {
+		path := fmt.Sprintf("routing.rules[%d]", i)
+		if len(r.Notify) == 0 {
+			v.add(path+".notify", "is empty")
+		}
+		v.notify(path+".notify", r.Notify, known)
+		v.targets(path+".cidrs", r.CIDRs)
+		v.groups(path+".groups", r.Groups, c.TargetGroups)
+		v.ports(path+".ports", r.Ports)
+		for j, ch := range r.Changes {
+			if _, err := diff.ParseChange(ch); err != nil {
+				v.add(fmt.Sprintf("%s.changes[%d]", path, j), "%v", err)
+			}
+		}
+		if r.MinSeverity != "" {
+			if _, err := diff.ParseSeverity(r.MinSeverity); err != nil {
+				v.add(path+".min_severity", "%v", err)
+			}
+		}
+	}
+
+	v.notify("health.notify", c.Health.Notify, known)
+	if c.Health.FailureThreshold < 0 {
+		v.add("health.failure_threshold", "must not be negative")
+	}
+	if c.Health.DropPercent < 0 || c.Health.DropPercent > 100 {
+		v.add("health.drop_percent", "must be between 0 and 100")
+	}
+	if c.Health.MinPrevious < 0 {
+		v.add("health.min_previous", "must not be negative")
+	}
+
+	v.duration("heartbeat.interval", c.Heartbeat.Interval, true)
+	v.notify("heartbeat.notify", c.Heartbeat.Notify, known)
+	if c.Heartbeat.PingURL != "" {
+		if u, err := url.Parse(c.Heartbeat.PingURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("heartbeat.ping_url", "invalid http(s) URL %q", c.Heartbeat.PingURL)
+		}
+	}
+
+	jobs := make(map[string]bool)
+	for i, j := range c.Jobs {
+		path := fmt.Sprintf("jobs[%d]", i)
+		switch {
+		case j.Name == "":
+			v.add(path+".name", "is empty")
+		case jobs[j.Name]:
+			v.add(path+".name", "duplicate job %q", j.Name)
+		}
+		jobs[j.Name] = true
+
+		if len(j.Targets) == 0 && j.TargetsFile == "" {
+			v.add(path+".targets", "no targets configured")
+		}
+		v.entries(path+".targets", j.Targets, true)
+		v.targetsFile(path+".targets_file", j.TargetsFile, true)
+		v.entries(path+".exclude", j.Exclude, false)
+		v.targetsFile(path+".exclude_file", j.ExcludeFile, false)
+		v.masscan(path+".masscan", j.Masscan, false, c)
+		if j.Masscan.Ports == "" && j.Masscan.UDPPorts == "" && c.Masscan.Ports == "" && c.Masscan.UDPPorts == "" {
+			v.add(path+".masscan.ports", "is empty and there is no top-level masscan.ports or udp_ports")
+		}
+		if j.Scheduler.Interval != "" || j.Scheduler.Cron != "" {
+			v.scheduler(path+".scheduler", j.Scheduler, true)
+		} else {
+			v.scheduler(path+".scheduler", j.Scheduler, false)
+			if c.Scheduler.Enabled && c.Scheduler.Interval == "" && c.Scheduler.Cron == "" {
+				v.add(path+".scheduler", "no interval or cron here or in the top-level scheduler")
+			}
+		}
+		v.notify(path+".notify", j.Notify, known)
+	}
+
+	windows := make(map[string]bool)
+	for i, m := range c.Maintenance {
+		path := fmt.Sprintf("maintenance[%d]", i)
+		switch {
+		case m.Name == "":
+			v.add(path+".name", "is empty")
+		case windows[m.Name]:
+			v.add(path+".name", "duplicate maintenance window %q", m.Name)
+		}
+		windows[m.Name] = true
+
+		switch m.Action {
+		case "", "skip", "suppress":
+		default:
+			v.add(path+".action", "unknown action %q, expected skip or suppress", m.Action)
+		}
+		v.timezone(path+".timezone", m.Timezone)
+
+		switch {
+		case m.Cron != "" && (m.From != "" || m.To != ""):
+			v.add(path, "cron and from/to are mutually exclusive")
+		case m.Cron != "":
+			v.cron(path+".cron", m.Cron)
+			if m.Duration == "" {
+				v.add(path+".duration", "is required for a recurring window")
+			}
+			v.duration(path+".duration", m.Duration, true)
+		case m.From != "" && m.To != "":
+			from, err1 := time.Parse("2006-01-02 15:04", m.From)
+			to, err2 := time.Parse("2006-01-02 15:04", m.To)
+			if err1 != nil {
+				v.add(path+".from", "invalid time %q, expected \"2006-01-02 15:04\"", m.From)
+			}
+			if err2 != nil {
+				v.add(path+".to", "invalid time %q, expected \"2006-01-02 15:04\"", m.To)
+			}
+			if err1 == nil && err2 == nil && !to.After(from) {
+				v.add(path+".to", "must be after from")
+			}
+		default:
+			v.add(path, "either cron with duration or from and to is required")
+		}
+		v.groups(path+".groups", m.Groups, c.TargetGroups)
+	}
+
+	v.control("control.listen", c.Control.Listen)
+	v.duration("reload.interval", c.Reload.Interval, true)
+}
+
+// control checks that the control interface, which has no authentication,
+// is reachable only from this host.
+func (v *validator) control(path, listen string) {
+	if listen == "" {
+		return
+	}
+	if sock, ok := strings.CutPrefix(listen, "unix:"); ok {
+		if sock == "" {
+			v.add(path, "unix socket path is empty")
+		}
+		return
+	}
+
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		v.add(path, "invalid address %q, expected unix:<path> or <loopback host>:<port>", listen)
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		v.add(path, "invalid port %q", port)
+	}
+	if host == "localhost" {
+		return
+	}
+	if addr, err := netip.ParseAddr(host); err != nil || !addr.Unmap().IsLoopback() {
+		v.add(path, "%q is not a loopback address; the control interface has no authentication, use unix:<path> or 127.0.0.1:<port>", listen)
+	}
+}
+
+func (v *validator) masscan(path string, m MasscanConfig, required bool, c *Config) {
+	if m.Ports == "" && m.UDPPorts == "" {
+		if required {
+			v.add(path+".ports", "is empty and there are no udp_ports")
+		}
+	}
+	for _, f := range []struct {
+		key   string
+		value PortList
+	}{{"ports", m.Ports}, {"udp_ports", m.UDPPorts}} {
+		if f.value == "" {
+			continue
+		}
+		if set, err := c.ExpandPorts(f.value); err != nil {
+			if strings.Contains(strings.ToUpper(string(f.value)), "U:") {
+				err = fmt.Errorf("%w (list UDP ports in udp_ports without U:)", err)
+			}
+			v.add(path+"."+f.key, "%v", err)
+		} else if len(set) == 0 {
+			v.add(path+"."+f.key, "no ports in %q", f.value)
+		}
+	}
+
+	if m.Rate != "" {
+		if rate, err := strconv.ParseFloat(m.Rate, 64); err != nil || rate <= 0 {
+			v.add(path+".rate", "must be a positive number of packets per second, got %q", m.Rate)
+		}
+	}
+	if strings.ContainsAny(m.Interface, " \t/") {
+		v.add(path+".interface", "invalid interface name %q", m.Interface)
+	}
+}
+
+func (v *validator) scheduler(path string, s SchedulerConfig, required bool) {
+	if s.Interval != "" && s.Cron != "" {
+		v.add(path, "interval and cron are mutually exclusive")
+	}
+	if s.Cron != "" {
+		v.cron(path+".cron", s.Cron)
+	} else if s.Interval != "" {
+		v.duration(path+".interval", s.Interval, true)
+	} else if required && s.Enabled {
+		v.add(path, "interval or cron is required")
+	}
+	v.timezone(path+".timezone", s.Timezone)
+
+	switch s.Overlap {
+	case "", "skip", "queue", "cancel":
+	default:
+		v.add(path+".overlap", "unknown overlap policy %q, expected skip, queue or cancel", s.Overlap)
+	}
+	v.duration(path+".jitter", s.Jitter, false)
+}
+
+// cron checks the shape of a cron expression; field values are checked
+// by the scheduler when the config is applied.
+func (v *validator) cron(path, expr string) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		switch expr {
+		case "@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly":
+		default:
+			v.add(path, "unknown cron macro %q", expr)
+		}
+		return
+	}
+	if n := len(strings.Fields(expr)); n != 5 {
+		v.add(path, "cron expression %q has %d fields, expected 5", expr, n)
+	}
+}
+
+func (v *validator) smtp(path string, s SMTPConfig) {
+	if s.Host == "" {
+		v.add(path+".host", "is empty (set it or SMTP_HOST)")
+	}
+	if s.Port <= 0 || s.Port > 65535 {
+		v.add(path+".port", "must be between 1 and 65535 (set it or SMTP_PORT)")
+	}
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		v.add(path+".from", "invalid address %q", s.From)
+	}
+	switch s.TLS {
+	case "", "starttls", "tls":
+	case "none":
+		// net/smtp refuses to send a password over plain text to other hosts
+		if s.User != "" && !isLocalhost(s.Host) {
+			v.add(path+".tls", "credentials are only sent without TLS to localhost, use starttls or tls for %s", s.Host)
+		}
+	default:
+		v.add(path+".tls", "unknown mode %q, expected none, starttls or tls", s.TLS)
+	}
+	if len(s.To)+len(s.Cc)+len(s.Bcc) == 0 {
+		v.add(path+".to", "no recipients (set it or SMTP_TO)")
+	}
+	v.addresses(path+".to", s.To)
+	v.addresses(path+".cc", s.Cc)
+	v.addresses(path+".bcc", s.Bcc)
+	if s.MaxBodyChanges < 0 {
+		v.add(path+".max_body_changes", "must not be negative")
+	}
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+func (v *validator) delivery(path string, d DeliveryConfig) {
+	switch d.Mode {
+	case "", "immediate":
+	case "batch":
+		if d.Every == "" {
+			v.add(path+".every", "is required in batch mode")
+		}
+		v.duration(path+".every", d.Every, true)
+	case "digest":
+		v.clock(path+".at", d.At)
+	default:
+		v.add(path+".mode", "unknown delivery mode %q, expected immediate, batch or digest", d.Mode)
+	}
+	v.timezone(path+".timezone", d.Timezone)
+
+	if d.QuietHours != "" {
+		from, to, ok := strings.Cut(d.QuietHours, "-")
+		if !ok {
+			v.add(path+".quiet_hours", "invalid %q, expected HH:MM-HH:MM", d.QuietHours)
+		} else if v.clock(path+".quiet_hours", from) {
+			v.clock(path+".quiet_hours", to)
+		}
+	}
+
+	switch d.BypassSeverity {
+	case "", "none":
+	default:
+		if _, err := diff.ParseSeverity(d.BypassSeverity); err != nil {
+			v.add(path+".bypass_severity", "%v", err)
+		}
+	}
+}
+
+func (v *validator) templates(path string, t TemplatesConfig) {
+	v.file(path+".text", t.Text)
+	v.file(path+".html", t.HTML)
+}
+
+func (v *validator) groups(path string, list []string, groups map[string][]string) {
+	for i, g := range list {
+		if _, ok := groups[g]; !ok {
+			v.add(fmt.Sprintf("%s[%d]", path, i), "unknown target group %q", g)
+		}
+	}
+}
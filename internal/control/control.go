@@ -0,0 +1,135 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/scheduler"
+	"go.uber.org/zap"
+)
+
+const unixPrefix = "unix:"
+
+// Server is a local HTTP control interface:
+//
+//	POST /scan[?job=name]  trigger a run of one or all jobs
+//	GET  /status           scheduling state of every job
+type Server struct {
+	listen string
+	group  *scheduler.Group
+	log    *zap.SugaredLogger
+}
+
+// New creates a server on listen, which is either "unix:/path/to.sock" or a
+// loopback TCP address such as "127.0.0.1:9090". Requests are not
+// authenticated; the config validation rejects other addresses.
+func New(listen string, group *scheduler.Group, log *zap.SugaredLogger) *Server {
+	return &Server{listen: listen, group: group, log: log}
+}
+
+// Run serves requests until ctx is done.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := s.listener()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /scan", s.handleScan)
+	mux.HandleFunc("GET /status", s.handleStatus)
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	s.log.Infof("Control interface listening on %s", s.listen)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) listener() (net.Listener, error) {
+	path, ok := strings.CutPrefix(s.listen, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", s.listen)
+	}
+
+	// a socket left over by a killed process blocks the bind
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return ln, nil
+}
+
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	job := r.URL.Query().Get("job")
+	queued, err := s.group.Trigger(job)
+
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil && len(queued) == 0:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	s.log.Infof("Scan triggered via control interface: %s", strings.Join(queued, ", "))
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "Scan triggered: %s\n", strings.Join(queued, ", "))
+	if err != nil {
+		fmt.Fprintf(w, "Rejected: %v\n", err)
+	}
+}
+
+type jobStatus struct {
+	Job       string     `json:"job"`
+	Running   bool       `json:"running"`
+	LastStart *time.Time `json:"last_start,omitempty"`
+	Next      *time.Time `json:"next,omitempty"`
+	Overruns  int        `json:"overruns"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	states := s.group.States()
+
+	out := make([]jobStatus, 0, len(states))
+	for _, name := range s.group.Names() {
+		st := states[name]
+		js := jobStatus{Job: name, Running: st.Running, Overruns: st.Overruns}
+		if !st.LastStart.IsZero() {
+			js.LastStart = &st.LastStart
+		}
+		if !st.Next.IsZero() {
+			js.Next = &st.Next
+		}
+		out = append(out, js)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		s.log.Errorf("Control status: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package delivery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+const (
+	ModeImmediate = "immediate"
+	ModeBatch     = "batch"
+	ModeDigest    = "digest"
+)
+
+// Policy decides when queued changes of a notifier are sent.
+type Policy struct {
+	mode  string
+	every time.Duration
+	// at is the digest time as an offset from midnight
+	at  time.Duration
+	loc *time.Location
+
+	quiet          bool
+	quietFrom      time.Duration
+	quietTo        time.Duration
+	bypass         diff.Severity
+	bypassDisabled bool
+}
+
+func ParsePolicy(cfg config.DeliveryConfig) (Policy, error) {
+	p := Policy{mode: cfg.Mode, loc: time.Local, bypass: diff.SeverityCritical}
+	if p.mode == "" {
+		p.mode = ModeImmediate
+	}
+
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return p, fmt.Errorf("timezone %q: %w", cfg.Timezone, err)
+		}
+		p.loc = loc
+	}
+
+	switch p.mode {
+	case ModeImmediate:
+	case ModeBatch:
+		every, err := time.ParseDuration(cfg.Every)
+		if err != nil || every <= 0 {
+			return p, fmt.Errorf("batch mode needs a positive every, got %q", cfg.Every)
+		}
+		p.every = every
+	case ModeDigest:
+		at, err := parseClock(cfg.At)
+		if err != nil {
+			return p, fmt.Errorf("digest at: %w", err)
+		}
+		p.at = at
+	default:
+		return p, fmt.Errorf("unknown delivery mode %q", cfg.Mode)
+	}
+
+	if cfg.QuietHours != "" {
+		from, to, ok := strings.Cut(cfg.QuietHours, "-")
+		if !ok {
+			return p, fmt.Errorf("quiet_hours %q: expected HH:MM-HH:MM", cfg.QuietHours)
+		}
+		var err error
+		if p.quietFrom, err = parseClock(from); err != nil {
+			return p, fmt.Errorf("quiet_hours: %w", err)
+		}
+		if p.quietTo, err = parseClock(to); err != nil {
+			return p, fmt.Errorf("quiet_hours: %w", err)
+		}
+		p.quiet = true
+	}
+
+	switch cfg.BypassSeverity {
+	case "":
+	case "none":
+		p.bypassDisabled = true
+	default:
+		sev, err := diff.ParseSeverity(cfg.BypassSeverity)
+		if err != nil {
+			return p, fmt.Errorf("bypass_severity: %w", err)
+		}
+		p.bypass = sev
+	}
+
+	return p, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// sinceMidnight returns the offset of t from local midnight in the policy timezone.
+func (p Policy) sinceMidnight(t time.Time) time.Duration {
+	t = t.In(p.loc)
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// Quiet reports whether now falls into quiet hours.
+func (p Policy) Quiet(now time.Time) bool {
+	if !p.quiet {
+		return false
+	}
+	cur := p.sinceMidnight(now)
+	if p.quietFrom <= p.quietTo {
+		return cur >= p.quietFrom && cur < p.quietTo
+	}
+	// window crosses midnight, e.g. 22:00-07:00
+	return cur >= p.quietFrom || cur < p.quietTo
+}
+
+// Immediate reports whether the policy sends changes as soon as they appear.
+func (p Policy) Immediate() bool {
+	return p.mode == ModeImmediate
+}
+
+// Bypasses reports whether a change is sent right away regardless of
+// delivery mode and quiet hours.
+func (p Policy) Bypasses(sev diff.Severity) bool {
+	return !p.bypassDisabled && sev >= p.bypass
+}
+
+// Due reports whether queued changes should be sent at now given the
+// time of the previous flush (zero if never).
+func (p Policy) Due(now, last time.Time) bool {
+	if p.Quiet(now) {
+		return false
+	}
+
+	switch p.mode {
+	case ModeBatch:
+		return last.IsZero() || now.Sub(last) >= p.every
+	case ModeDigest:
+		local := now.In(p.loc)
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, p.loc)
+		scheduled := midnight.Add(p.at)
+		if scheduled.After(now) {
+			scheduled = scheduled.AddDate(0, 0, -1)
+		}
+		return last.Before(scheduled)
+	}
+	return true
+}
+
+// Merge folds queued changes in order into a single diff: the last change
+// of a port wins, a port that opened and closed again inside the window is
+// dropped, and a changed banner of a new port keeps it new.
+func Merge(entries []model.QueuedChange) diff.DiffResult {
+	type state struct {
+		change diff.Change
+		result model.ScanResult
+	}
+
+	var order []string
+	seen := make(map[string]bool)
+	states := make(map[string]*state)
+
+	for _, e := range entries {
+		change := diff.Change(e.Change)
+		key := e.Result.Key()
+
+		if !seen[key] {
+			seen[key] = true
+			order = append(order, key)
+		}
+
+		st, ok := states[key]
+		if !ok {
+			states[key] = &state{change: change, result: e.Result}
+			continue
+		}
+
+		switch {
+		case st.change == diff.ChangeNew && change == diff.ChangeClosed:
+			delete(states, key)
+			continue
+		case st.change == diff.ChangeNew && change == diff.ChangeChanged:
+			change = diff.ChangeNew
+		}
+		st.change, st.result = change, e.Result
+	}
+
+	var d diff.DiffResult
+	for _, key := range order {
+		if st, ok := states[key]; ok {
+			d.Add(st.change, st.result)
+		}
+	}
+	return d
+}
@@ -0,0 +1,232 @@
+package delivery
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+func mustPolicy(t *testing.T, cfg config.DeliveryConfig) Policy {
+	t.Helper()
+	cfg.Timezone = "UTC"
+	p, err := ParsePolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func at(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		cfg config.DeliveryConfig
+		err string
+	}{
+		{config.DeliveryConfig{Mode: "hourly"}, "unknown delivery mode"},
+		{config.DeliveryConfig{Mode: ModeBatch}, "positive every"},
+		{config.DeliveryConfig{Mode: ModeBatch, Every: "-5m"}, "positive every"},
+		{config.DeliveryConfig{Mode: ModeDigest, At: "25:00"}, "digest at"},
+		{config.DeliveryConfig{Timezone: "Mars/Olympus"}, "timezone"},
+		{config.DeliveryConfig{QuietHours: "22:00"}, "expected HH:MM-HH:MM"},
+		{config.DeliveryConfig{QuietHours: "22:00-7am"}, "quiet_hours"},
+		{config.DeliveryConfig{BypassSeverity: "urgent"}, "bypass_severity"},
+	}
+	for _, tt := range tests {
+		if _, err := ParsePolicy(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParsePolicy(%+v) error = %v, want %q", tt.cfg, err, tt.err)
+		}
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	overnight := mustPolicy(t, config.DeliveryConfig{QuietHours: "22:00-07:00"})
+	daytime := mustPolicy(t, config.DeliveryConfig{QuietHours: "12:00-13:30"})
+	none := mustPolicy(t, config.DeliveryConfig{})
+
+	tests := []struct {
+		p    Policy
+		now  string
+		want bool
+	}{
+		{overnight, "2026-03-10 21:59", false},
+		{overnight, "2026-03-10 22:00", true},
+		{overnight, "2026-03-11 03:00", true},
+		{overnight, "2026-03-11 06:59", true},
+		{overnight, "2026-03-11 07:00", false},
+		{daytime, "2026-03-10 11:59", false},
+		{daytime, "2026-03-10 13:29", true},
+		{daytime, "2026-03-10 13:30", false},
+		{none, "2026-03-10 23:00", false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Quiet(at(tt.now)); got != tt.want {
+			t.Errorf("Quiet(%s) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestBypasses(t *testing.T) {
+	def := mustPolicy(t, config.DeliveryConfig{Mode: ModeBatch, Every: "1h"})
+	high := mustPolicy(t, config.DeliveryConfig{Mode: ModeBatch, Every: "1h", BypassSeverity: "high"})
+	off := mustPolicy(t, config.DeliveryConfig{Mode: ModeBatch, Every: "1h", BypassSeverity: "none"})
+
+	if def.Bypasses(diff.SeverityHigh) || !def.Bypasses(diff.SeverityCritical) {
+		t.Error("default policy should bypass only critical changes")
+	}
+	if !high.Bypasses(diff.SeverityHigh) || high.Bypasses(diff.SeverityMedium) {
+		t.Error("bypass_severity high should bypass high and critical changes")
+	}
+	if off.Bypasses(diff.SeverityCritical) {
+		t.Error("bypass_severity none should never bypass")
+	}
+}
+
+func TestDue(t *testing.T) {
+	immediate := mustPolicy(t, config.DeliveryConfig{QuietHours: "22:00-07:00"})
+	batch := mustPolicy(t, config.DeliveryConfig{Mode: ModeBatch, Every: "30m"})
+	digest := mustPolicy(t, config.DeliveryConfig{Mode: ModeDigest, At: "09:00"})
+	quietDigest := mustPolicy(t, config.DeliveryConfig{Mode: ModeDigest, At: "06:00", QuietHours: "22:00-07:00"})
+
+	tests := []struct {
+		name      string
+		p         Policy
+		now, last string
+		want      bool
+	}{
+		{"immediate outside quiet hours", immediate, "2026-03-10 07:00", "2026-03-10 06:00", true},
+		{"immediate in quiet hours", immediate, "2026-03-10 23:00", "", false},
+
+		{"batch never flushed", batch, "2026-03-10 10:00", "", true},
+		{"batch inside the window", batch, "2026-03-10 10:29", "2026-03-10 10:00", false},
+		{"batch window over", batch, "2026-03-10 10:30", "2026-03-10 10:00", true},
+
+		{"digest before today's time", digest, "2026-03-10 08:59", "2026-03-09 09:00", false},
+		{"digest at today's time", digest, "2026-03-10 09:00", "2026-03-09 09:00", true},
+		{"digest missed while down", digest, "2026-03-10 15:00", "2026-03-08 09:00", true},
+		{"digest already sent today", digest, "2026-03-10 15:00", "2026-03-10 09:00", false},
+		// the window of a change queued after the digest time starts at the change
+		{"digest window started after today's time", digest, "2026-03-10 10:01", "2026-03-10 10:00", false},
+		{"digest next day", digest, "2026-03-11 09:00", "2026-03-10 10:00", true},
+		{"digest window started before today's time", digest, "2026-03-10 09:00", "2026-03-10 08:00", true},
+
+		{"digest held by quiet hours", quietDigest, "2026-03-10 06:30", "2026-03-09 06:00", false},
+		{"digest after quiet hours", quietDigest, "2026-03-10 07:00", "2026-03-09 06:00", true},
+	}
+	for _, tt := range tests {
+		var last time.Time
+		if tt.last != "" {
+			last = at(tt.last)
+		}
+		if got := tt.p.Due(at(tt.now), last); got != tt.want {
+			t.Errorf("%s: Due(%s, %s) = %v, want %v", tt.name, tt.now, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestDigestTimezone(t *testing.T) {
+	p, err := ParsePolicy(config.DeliveryConfig{Mode: ModeDigest, At: "09:00", Timezone: "Asia/Tokyo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 09:00 in Tokyo is 00:00 UTC
+	if p.Due(at("2026-03-09 23:59"), at("2026-03-09 00:00")) {
+		t.Error("digest due before 09:00 Tokyo time")
+	}
+	if !p.Due(at("2026-03-10 00:00"), at("2026-03-09 00:00")) {
+		t.Error("digest not due at 09:00 Tokyo time")
+	}
+}
+
+func queued(change diff.Change, ip string, port int, banner string) model.QueuedChange {
+	return model.QueuedChange{
+		Change: string(change),
+		Result: model.ScanResult{IP: ip, Port: port, Proto: "tcp", Banner: banner},
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []model.QueuedChange
+		want    []string
+	}{
+		{
+			name:    "empty",
+			entries: nil,
+			want:    nil,
+		},
+		{
+			name: "distinct ports keep queue order",
+			entries: []model.QueuedChange{
+				queued(diff.ChangeClosed, "10.0.0.2", 80, ""),
+				queued(diff.ChangeNew, "10.0.0.1", 22, "ssh"),
+				queued(diff.ChangeChanged, "10.0.0.3", 443, "nginx"),
+			},
+			want: []string{"new 10.0.0.1:22/tcp ssh", "changed 10.0.0.3:443/tcp nginx", "closed 10.0.0.2:80/tcp "},
+		},
+		{
+			name: "opened and closed inside the window is dropped",
+			entries: []model.QueuedChange{
+				queued(diff.ChangeNew, "10.0.0.1", 22, ""),
+				queued(diff.ChangeNew, "10.0.0.1", 80, ""),
+				queued(diff.ChangeClosed, "10.0.0.1", 22, ""),
+			},
+			want: []string{"new 10.0.0.1:80/tcp "},
+		},
+		{
+			name: "changed banner of a new port stays new",
+			entries: []model.QueuedChange{
+				queued(diff.ChangeNew, "10.0.0.1", 22, "OpenSSH_8"),
+				queued(diff.ChangeChanged, "10.0.0.1", 22, "OpenSSH_9"),
+			},
+			want: []string{"new 10.0.0.1:22/tcp OpenSSH_9"},
+		},
+		{
+			name: "last change wins",
+			entries: []model.QueuedChange{
+				queued(diff.ChangeChanged, "10.0.0.1", 22, "OpenSSH_9"),
+				queued(diff.ChangeClosed, "10.0.0.1", 22, ""),
+			},
+			want: []string{"closed 10.0.0.1:22/tcp "},
+		},
+		{
+			name: "closed and opened again",
+			entries: []model.QueuedChange{
+				queued(diff.ChangeClosed, "10.0.0.1", 22, "OpenSSH_8"),
+				queued(diff.ChangeNew, "10.0.0.1", 22, "OpenSSH_9"),
+			},
+			want: []string{"new 10.0.0.1:22/tcp OpenSSH_9"},
+		},
+		{
+			name: "reopened after being dropped",
+			entries: []model.QueuedChange{
+				queued(diff.ChangeNew, "10.0.0.1", 22, ""),
+				queued(diff.ChangeClosed, "10.0.0.1", 22, ""),
+				queued(diff.ChangeNew, "10.0.0.1", 22, "ssh"),
+			},
+			want: []string{"new 10.0.0.1:22/tcp ssh"},
+		},
+	}
+	for _, tt := range tests {
+		d := Merge(tt.entries)
+		var got []string
+		d.Each(func(change diff.Change, r model.ScanResult) {
+			got = append(got, string(change)+" "+r.Key()+" "+r.Banner)
+		})
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Merge = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
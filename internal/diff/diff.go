@@ -34,4 +34,30 @@ func Compare(current []model.ScanResult, previous map[string]model.ScanResult) D
 	}
 
 	return result
-}
\ No newline at end of file
+}
+
+// Total returns the number of changes of all kinds.
+func (d DiffResult) Total() int {
+	return len(d.New) + len(d.Changed) + len(d.Closed)
+}
+
+// Head returns at most n changes, taking new ports first, then changed, then closed.
+func (d DiffResult) Head(n int) DiffResult {
+	var head DiffResult
+
+	take := func(src []model.ScanResult) []model.ScanResult {
+		if n <= 0 || len(src) == 0 {
+			return nil
+		}
+		if len(src) > n {
+			src = src[:n]
+		}
+		n -= len(src)
+		return src
+	}
+
+	head.New = take(d.New)
+	head.Changed = take(d.Changed)
+	head.Closed = take(d.Closed)
+	return head
+}
@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
+)
+
+type Change string
+
+const (
+	ChangeNew     Change = "new"
+	ChangeChanged Change = "changed"
+	ChangeClosed  Change = "closed"
+)
+
+type Severity int
+
+const (
+	SeverityLow Severity = iota
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityLow, fmt.Errorf("unknown severity %q", s)
+}
+
+func ParseChange(s string) (Change, error) {
+	switch c := Change(strings.ToLower(s)); c {
+	case ChangeNew, ChangeChanged, ChangeClosed:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown change type %q", s)
+}
+
+// Classifier assigns a severity to a change: new ports are medium,
+// changed and closed ones low; ports from the high/critical lists raise
+// new and changed ports to that level.
+type Classifier struct {
+	Critical portset.Set
+	High     portset.Set
+}
+
+func (c Classifier) Severity(change Change, r model.ScanResult) Severity {
+	base := SeverityLow
+	if change == ChangeNew {
+		base = SeverityMedium
+	}
+	if change == ChangeClosed {
+		return base
+	}
+
+	switch {
+	case c.Critical.Contains(r.Port):
+		return SeverityCritical
+	case c.High.Contains(r.Port):
+		return SeverityHigh
+	}
+	return base
+}
+
+// Max returns the highest severity in the diff.
+func (c Classifier) Max(d DiffResult) Severity {
+	max := SeverityLow
+	d.Each(func(change Change, r model.ScanResult) {
+		if s := c.Severity(change, r); s > max {
+			max = s
+		}
+	})
+	return max
+}
+
+// Each calls fn for every change in the diff.
+func (d DiffResult) Each(fn func(change Change, r model.ScanResult)) {
+	for _, r := range d.New {
+		fn(ChangeNew, r)
+	}
+	for _, r := range d.Changed {
+		fn(ChangeChanged, r)
+	}
+	for _, r := range d.Closed {
+		fn(ChangeClosed, r)
+	}
+}
+
+// Add appends r to the list of the given change type.
+func (d *DiffResult) Add(change Change, r model.ScanResult) {
+	switch change {
+	case ChangeNew:
+		d.New = append(d.New, r)
+	case ChangeChanged:
+		d.Changed = append(d.Changed, r)
+	case ChangeClosed:
+		d.Closed = append(d.Closed, r)
+	}
+}
@@ -0,0 +1,50 @@
+package health
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+// Checker decides when the scanner itself looks broken.
+type Checker struct {
+	// AlertOnError alerts on every failed run.
+	AlertOnError bool
+	// FailureThreshold alerts once when this many runs in a row have failed.
+	FailureThreshold int
+	// DropPercent alerts when the number of open ports falls by more than
+	// this percentage compared to the previous successful run; 0 disables.
+	DropPercent float64
+	// MinPrevious is the smallest previous result count the drop check applies to.
+	MinPrevious int
+}
+
+// Failed returns an alert text for a failed run, consecutive includes it.
+func (c Checker) Failed(run model.RunSummary, consecutive int) (string, bool) {
+	if c.FailureThreshold > 0 && consecutive == c.FailureThreshold {
+		return fmt.Sprintf("%d scan runs in a row have failed.\nLast error: %s", consecutive, run.Err), true
+	}
+	if c.AlertOnError {
+		return fmt.Sprintf("Scan run started at %s failed (%d in a row).\nError: %s",
+			run.StartedAt.Format(time.DateTime), consecutive, run.Err), true
+	}
+	return "", false
+}
+
+// Dropped returns an alert text if results dropped suspiciously compared to prev.
+func (c Checker) Dropped(results int, prev model.RunSummary) (string, bool) {
+	if c.DropPercent <= 0 || prev.Results == 0 || prev.Results < c.MinPrevious {
+		return "", false
+	}
+
+	drop := float64(prev.Results-results) / float64(prev.Results) * 100
+	if drop <= c.DropPercent {
+		return "", false
+	}
+
+	return fmt.Sprintf("Open ports dropped from %d to %d (-%.0f%%) compared to the run at %s.\n"+
+		"This usually means the scanner is broken (interface, permissions, rate), "+
+		"so the change is not reported while the drop lasts.",
+		prev.Results, results, drop, prev.StartedAt.Format(time.DateTime)), true
+}
@@ -0,0 +1,86 @@
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Pinger reports run results to a dead-man's-switch service such as
+// healthchecks.io: the URL itself on success, URL + "/fail" on errors.
+type Pinger struct {
+	url    string
+	client *http.Client
+	log    *zap.SugaredLogger
+}
+
+func NewPinger(url string, log *zap.SugaredLogger) *Pinger {
+	return &Pinger{
+		url:    strings.TrimRight(url, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+		log:    log,
+	}
+}
+
+func (p *Pinger) Success(ctx context.Context) {
+	p.ping(ctx, p.url, "")
+}
+
+// Fail sends the error text as the request body so it shows up in the service.
+func (p *Pinger) Fail(ctx context.Context, reason string) {
+	p.ping(ctx, p.url+"/fail", reason)
+}
+
+func (p *Pinger) ping(ctx context.Context, url, body string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		p.log.Errorf("Healthcheck ping failed: %v", err)
+		return
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.log.Errorf("Healthcheck ping failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		p.log.Errorf("Healthcheck ping failed: %s", resp.Status)
+	}
+}
+
+// Run calls send every interval until ctx is done.
+func Run(ctx context.Context, interval time.Duration, send func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			send(ctx)
+		}
+	}
+}
+
+// Message builds the "still alive" text.
+func Message(last time.Time, lastErr string, ports int) string {
+	if last.IsZero() {
+		return fmt.Sprintf("Still alive. No runs yet, %d ports monitored.", ports)
+	}
+
+	status := "ok"
+	if lastErr != "" {
+		status = "failed: " + lastErr
+	}
+	return fmt.Sprintf("Still alive. Last run at %s (%s), %d ports monitored.",
+		last.Format(time.DateTime), status, ports)
+}
@@ -0,0 +1,183 @@
+package maintenance
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/scheduler"
+	"github.com/Qwental/port-scanner-alert-system/internal/target"
+)
+
+type Action string
+
+const (
+	// ActionSkip skips scans of the covered targets.
+	ActionSkip Action = "skip"
+	// ActionSuppress scans as usual but holds notifications until the window ends.
+	ActionSuppress Action = "suppress"
+)
+
+const timeLayout = "2006-01-02 15:04"
+
+// Window is a recurring or one-off blackout period.
+type Window struct {
+	Name   string
+	Action Action
+
+	// recurring windows
+	start    scheduler.Schedule
+	duration time.Duration
+	// one-off windows
+	from, to time.Time
+
+	// prefixes is empty when the window covers all targets
+	prefixes []netip.Prefix
+}
+
+// Parse builds windows from config, resolving target groups to prefixes.
+func Parse(cfgs []config.MaintenanceConfig, groups map[string][]string) ([]Window, error) {
+	windows := make([]Window, 0, len(cfgs))
+	seen := make(map[string]bool)
+
+	for i, c := range cfgs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("maintenance window %d: name is empty", i+1)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("duplicate maintenance window %q", c.Name)
+		}
+		seen[c.Name] = true
+
+		w, err := parseWindow(c, groups)
+		if err != nil {
+			return nil, fmt.Errorf("maintenance window %q: %w", c.Name, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func parseWindow(c config.MaintenanceConfig, groups map[string][]string) (Window, error) {
+	w := Window{Name: c.Name, Action: Action(c.Action)}
+
+	switch w.Action {
+	case "":
+		w.Action = ActionSuppress
+	case ActionSkip, ActionSuppress:
+	default:
+		return w, fmt.Errorf("unknown action %q", c.Action)
+	}
+
+	loc := time.Local
+	if c.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return w, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+		}
+	}
+
+	switch {
+	case c.Cron != "" && (c.From != "" || c.To != ""):
+		return w, fmt.Errorf("cron and from/to are mutually exclusive")
+	case c.Cron != "":
+		start, err := scheduler.ParseCron(c.Cron, loc)
+		if err != nil {
+			return w, err
+		}
+		duration, err := time.ParseDuration(c.Duration)
+		if err != nil || duration <= 0 {
+			return w, fmt.Errorf("recurring window needs a positive duration, got %q", c.Duration)
+		}
+		w.start, w.duration = start, duration
+	case c.From != "" && c.To != "":
+		var err error
+		if w.from, err = time.ParseInLocation(timeLayout, c.From, loc); err != nil {
+			return w, fmt.Errorf("invalid from %q, expected %q", c.From, timeLayout)
+		}
+		if w.to, err = time.ParseInLocation(timeLayout, c.To, loc); err != nil {
+			return w, fmt.Errorf("invalid to %q, expected %q", c.To, timeLayout)
+		}
+		if !w.to.After(w.from) {
+			return w, fmt.Errorf("to must be after from")
+		}
+	default:
+		return w, fmt.Errorf("either cron with duration or from and to is required")
+	}
+
+	for _, g := range c.Groups {
+		members, ok := groups[g]
+		if !ok {
+			return w, fmt.Errorf("unknown target group %q", g)
+		}
+		for _, m := range members {
+			prefixes, err := target.Parse(m)
+			if err != nil {
+				return w, fmt.Errorf("target group %q: %w", g, err)
+			}
+			w.prefixes = append(w.prefixes, prefixes...)
+		}
+	}
+
+	return w, nil
+}
+
+// Active reports whether now falls into the window.
+func (w Window) Active(now time.Time) bool {
+	if w.start == nil {
+		return !now.Before(w.from) && now.Before(w.to)
+	}
+	// the latest start within the last duration, if any
+	start := w.start.Next(now.Add(-w.duration))
+	return !start.After(now)
+}
+
+// Covers reports whether the address belongs to the window's targets.
+func (w Window) Covers(addr netip.Addr) bool {
+	return len(w.prefixes) == 0 || target.ContainsAddr(w.prefixes, addr)
+}
+
+// Prefixes returns the window's targets, nil if it covers all of them.
+func (w Window) Prefixes() []netip.Prefix {
+	return w.prefixes
+}
+
+// CoversTarget reports whether every address of a masscan target belongs to
+// the window's targets.
+func (w Window) CoversTarget(t string) bool {
+	if len(w.prefixes) == 0 {
+		return true
+	}
+
+	prefixes, err := target.Parse(t)
+	if err != nil {
+		return false
+	}
+	for _, p := range prefixes {
+		if !w.coversPrefix(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w Window) coversPrefix(p netip.Prefix) bool {
+	for _, wp := range w.prefixes {
+		if wp.Bits() <= p.Bits() && wp.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveWindows returns the windows with the given action active at now.
+func ActiveWindows(windows []Window, action Action, now time.Time) []Window {
+	var out []Window
+	for _, w := range windows {
+		if w.Action == action && w.Active(now) {
+			out = append(out, w)
+		}
+	}
+	return out
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// OutboxEntry is a single notification delivery stored before sending.
+type OutboxEntry struct {
+	ID          int64
+	Channel     string
+	Payload     []byte
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// QueuedChange is a diff entry held back by a notifier's delivery policy.
+type QueuedChange struct {
+	ID       int64
+	Channel  string
+	Change   string
+	Result   ScanResult
+	QueuedAt time.Time
+}
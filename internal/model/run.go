@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// RunSummary describes a single scan run.
+type RunSummary struct {
+	Job        string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Results    int
+	New        int
+	Changed    int
+	Closed     int
+	Err        string
+	// Suspicious marks a run whose results dropped too much to be trusted;
+	// it is not diffed and not used as the reference for later runs.
+	Suspicious bool
+	// Ports are the scanned ports in masscan syntax, profiles expanded.
+	Ports string
+}
+
+// JobState is the scheduling state of a job.
+type JobState struct {
+	Running   bool
+	LastStart time.Time
+	Next      time.Time
+	// Overruns counts activations that were due while a run was in progress.
+	Overruns int
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"net"
+	"net/netip"
 	"strconv"
 	"time"
 )
@@ -22,7 +24,9 @@ type MasscanOutput struct {
 }
 
 type ScanResult struct {
-	IP        string
+	IP string
+	// Hostname is the target name IP was resolved from, if any.
+	Hostname  string
 	Port      int
 	Proto     string
 	Banner    string
@@ -30,6 +34,44 @@ type ScanResult struct {
 	LastSeen  time.Time
 }
 
+// Addr returns the parsed address, IPv4-mapped IPv6 unmapped; it is not
+// valid if IP is not an address.
+func (r ScanResult) Addr() netip.Addr {
+	addr, _ := netip.ParseAddr(r.IP)
+	return addr.Unmap()
+}
+
+// Host returns the address for display, with the name it was resolved from:
+// "web01.corp (10.0.0.5)".
+func (r ScanResult) Host() string {
+	ip := r.IP
+	if addr := r.Addr(); addr.IsValid() {
+		ip = addr.String()
+	}
+	if r.Hostname == "" {
+		return ip
+	}
+	return r.Hostname + " (" + ip + ")"
+}
+
+// HostPort returns the host and port for display, with IPv6 addresses in
+// brackets: "10.0.0.5:443", "[2001:db8::5]:443", "web01.corp (2001:db8::5):443".
+func (r ScanResult) HostPort() string {
+	if r.Hostname != "" {
+		return r.Host() + ":" + strconv.Itoa(r.Port)
+	}
+	return joinHostPort(r.IP, r.Port)
+}
+
+// Key identifies an open port. The address is normalized, so different
+// spellings of one IPv6 address have the same key.
 func (r ScanResult) Key() string {
-	return r.IP + ":" + strconv.Itoa(r.Port) + "/" + r.Proto
+	return joinHostPort(r.IP, r.Port) + "/" + r.Proto
+}
+
+func joinHostPort(ip string, port int) string {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return netip.AddrPortFrom(addr.Unmap(), uint16(port)).String()
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
 }
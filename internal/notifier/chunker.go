@@ -0,0 +1,204 @@
+package notifier
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// partHeaderReserve is the room kept in every part for the "(2/5)" header.
+const partHeaderReserve = 16
+
+var tagRe = regexp.MustCompile(`<(/?)([a-zA-Z]+)[^>]*>`)
+
+// Chunker splits long messages into numbered parts for channels with
+// a message size limit. Messages are split on block boundaries first
+// (a line without indentation starts a new block: section or host),
+// then on lines, and only as a last resort inside a line.
+type Chunker struct {
+	// Limit is the max number of runes per part, header included.
+	Limit int
+	// HTML enables tag tracking: tags left open at the end of a part
+	// are closed there and reopened at the start of the next one.
+	HTML bool
+}
+
+type openTag struct {
+	name string
+	raw  string
+}
+
+func (c Chunker) Split(message string) []string {
+	if c.Limit <= 0 || utf8.RuneCountInString(message) <= c.Limit {
+		return []string{message}
+	}
+
+	budget := c.Limit - partHeaderReserve
+
+	var (
+		parts []string
+		cur   strings.Builder
+		open  []openTag
+		dirty bool
+	)
+
+	flush := func() {
+		if !dirty {
+			return
+		}
+		parts = append(parts, cur.String()+closeTags(open))
+		cur.Reset()
+		cur.WriteString(reopenTags(open))
+		dirty = false
+	}
+
+	fits := func(piece string) bool {
+		next := c.track(open, piece)
+		return runeLen(cur.String())+runeLen(piece)+runeLen(closeTags(next)) <= budget
+	}
+
+	fitsFresh := func(piece string) bool {
+		next := c.track(open, piece)
+		return runeLen(reopenTags(open))+runeLen(piece)+runeLen(closeTags(next)) <= budget
+	}
+
+	add := func(piece string) {
+		if dirty && !fits(piece) {
+			flush()
+		}
+		cur.WriteString(piece)
+		open = c.track(open, piece)
+		dirty = true
+	}
+
+	for _, block := range c.blocks(message) {
+		if fits(block) || fitsFresh(block) {
+			add(block)
+			continue
+		}
+
+		for _, line := range strings.SplitAfter(block, "\n") {
+			if line == "" {
+				continue
+			}
+			if fits(line) || fitsFresh(line) {
+				add(line)
+				continue
+			}
+			for rest := line; rest != ""; {
+				flush()
+				room := budget - runeLen(reopenTags(open)) -
+					runeLen(closeTags(open)) - runeLen(closeTags(c.track(open, rest)))
+				piece := c.cut(rest, room)
+				add(piece)
+				rest = rest[len(piece):]
+			}
+		}
+	}
+	flush()
+
+	if len(parts) <= 1 {
+		return parts
+	}
+
+	for i := range parts {
+		parts[i] = fmt.Sprintf("(%d/%d)\n", i+1, len(parts)) + parts[i]
+	}
+	return parts
+}
+
+// blocks groups lines so that a non-indented line outside of open tags
+// starts a new block.
+func (c Chunker) blocks(message string) []string {
+	var (
+		blocks []string
+		cur    strings.Builder
+		open   []openTag
+	)
+
+	for _, line := range strings.SplitAfter(message, "\n") {
+		if line == "" {
+			continue
+		}
+		starts := len(open) == 0 && strings.TrimSpace(line) != "" &&
+			line[0] != ' ' && line[0] != '\t'
+		if starts && cur.Len() > 0 {
+			blocks = append(blocks, cur.String())
+			cur.Reset()
+		}
+		cur.WriteString(line)
+		open = c.track(open, line)
+	}
+
+	if cur.Len() > 0 {
+		blocks = append(blocks, cur.String())
+	}
+	return blocks
+}
+
+// cut returns the longest prefix of line of at most size runes
+// that does not end inside an HTML tag or entity.
+func (c Chunker) cut(line string, size int) string {
+	if size < 1 {
+		size = 1
+	}
+
+	runes := []rune(line)
+	if size >= len(runes) {
+		return line
+	}
+
+	piece := string(runes[:size])
+	if c.HTML {
+		if i := strings.LastIndexByte(piece, '<'); i > strings.LastIndexByte(piece, '>') && i > 0 {
+			piece = piece[:i]
+		} else if i := strings.LastIndexByte(piece, '&'); i > strings.LastIndexByte(piece, ';') && i > 0 {
+			piece = piece[:i]
+		}
+	}
+	return piece
+}
+
+// track returns the tag stack after appending piece.
+func (c Chunker) track(open []openTag, piece string) []openTag {
+	if !c.HTML {
+		return nil
+	}
+
+	next := append([]openTag(nil), open...)
+	for _, m := range tagRe.FindAllStringSubmatch(piece, -1) {
+		name := strings.ToLower(m[2])
+		if m[1] == "" {
+			next = append(next, openTag{name: name, raw: m[0]})
+			continue
+		}
+		for i := len(next) - 1; i >= 0; i-- {
+			if next[i].name == name {
+				next = next[:i]
+				break
+			}
+		}
+	}
+	return next
+}
+
+func closeTags(open []openTag) string {
+	var b strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i].name + ">")
+	}
+	return b.String()
+}
+
+func reopenTags(open []openTag) string {
+	var b strings.Builder
+	for _, t := range open {
+		b.WriteString(t.raw)
+	}
+	return b.String()
+}
+
+func runeLen(s string) int {
+	return utf8.RuneCountInString(s)
+}
@@ -0,0 +1,227 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stripPartHeader returns the part without its "(i/n)" header, failing if
+// the header is missing or numbered wrong.
+func stripPartHeader(t *testing.T, part string, i, n int) string {
+	t.Helper()
+	header := fmt.Sprintf("(%d/%d)\n", i+1, n)
+	body, ok := strings.CutPrefix(part, header)
+	if !ok {
+		t.Fatalf("part %d does not start with %q: %.40q", i+1, header, part)
+	}
+	return body
+}
+
+// checkTags fails if part closes a tag it did not open or leaves one open.
+func checkTags(t *testing.T, part string) {
+	t.Helper()
+	var open []string
+	for _, m := range tagRe.FindAllStringSubmatch(part, -1) {
+		name := strings.ToLower(m[2])
+		if m[1] == "" {
+			open = append(open, name)
+			continue
+		}
+		if len(open) == 0 || open[len(open)-1] != name {
+			t.Errorf("part closes <%s> with %v open: %.60q", name, open, part)
+			return
+		}
+		open = open[:len(open)-1]
+	}
+	if len(open) > 0 {
+		t.Errorf("part leaves %v open: %.60q", open, part)
+	}
+}
+
+// checkCuts fails if part contains a broken tag or entity.
+func checkCuts(t *testing.T, part string) {
+	t.Helper()
+	if n := len(tagRe.FindAllString(part, -1)); n != strings.Count(part, "<") || n != strings.Count(part, ">") {
+		t.Errorf("part has a cut tag: %q", part)
+	}
+	for rest := part; ; {
+		i := strings.IndexByte(rest, '&')
+		if i < 0 {
+			break
+		}
+		rest = rest[i+1:]
+		if end := strings.IndexByte(rest, ';'); end < 0 || end > 5 || strings.ContainsAny(rest[:end], " <&\n") {
+			t.Errorf("part has a cut entity: %q", part)
+			break
+		}
+	}
+}
+
+func stripTags(s string) string {
+	return tagRe.ReplaceAllString(s, "")
+}
+
+func TestChunkerShortMessage(t *testing.T) {
+	for _, c := range []Chunker{{}, {Limit: 4096}, {Limit: 4096, HTML: true}} {
+		msg := "<b>Port Scanner</b>\nNEW 10.0.0.1:22"
+		if got := c.Split(msg); len(got) != 1 || got[0] != msg {
+			t.Errorf("%+v: Split = %q, want the message unchanged", c, got)
+		}
+	}
+}
+
+func TestChunkerSplit(t *testing.T) {
+	var hosts strings.Builder
+	for i := range 300 {
+		fmt.Fprintf(&hosts, "10.0.%d.%d\n  NEW 22/tcp ssh\n  NEW 443/tcp https\n", i/256, i%256)
+	}
+	longLine := strings.Repeat("x", 9000) + "\n"
+
+	tests := []struct {
+		name    string
+		chunker Chunker
+		message string
+	}{
+		{"blocks at the telegram limit", Chunker{Limit: 4096}, hosts.String()},
+		{"line longer than a part", Chunker{Limit: 4096}, "header\n" + longLine + "footer\n"},
+		{"multibyte runes", Chunker{Limit: 4096}, strings.Repeat("порт открыт\n", 900)},
+		{"small limit", Chunker{Limit: 40}, hosts.String()[:600]},
+		{"html blocks", Chunker{Limit: 4096, HTML: true}, "<b>Changes</b>\n<pre>" + hosts.String() + "</pre>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := tt.chunker.Split(tt.message)
+			if len(parts) < 2 {
+				t.Fatalf("Split returned %d parts, want several", len(parts))
+			}
+
+			var joined strings.Builder
+			for i, p := range parts {
+				if n := runeLen(p); n > tt.chunker.Limit {
+					t.Errorf("part %d has %d runes, limit %d", i+1, n, tt.chunker.Limit)
+				}
+				body := stripPartHeader(t, p, i, len(parts))
+				if tt.chunker.HTML {
+					checkTags(t, body)
+					body = stripTags(body)
+				}
+				joined.WriteString(body)
+			}
+
+			want := tt.message
+			if tt.chunker.HTML {
+				want = stripTags(want)
+			}
+			if joined.String() != want {
+				t.Error("parts joined do not give the message back")
+			}
+		})
+	}
+}
+
+func TestChunkerSplitsOnBlocks(t *testing.T) {
+	var b strings.Builder
+	for i := range 200 {
+		fmt.Fprintf(&b, "10.0.0.%d\n  NEW 22/tcp\n  NEW 80/tcp\n", i)
+	}
+	parts := Chunker{Limit: 500}.Split(b.String())
+
+	for i, p := range parts {
+		body := stripPartHeader(t, p, i, len(parts))
+		if !strings.HasPrefix(body, "10.0.0.") {
+			t.Errorf("part %d does not start with a host: %.30q", i+1, body)
+		}
+		if !strings.HasSuffix(body, "80/tcp\n") {
+			t.Errorf("part %d does not end with a whole host: %q", i+1, body[max(0, len(body)-30):])
+		}
+	}
+}
+
+func TestChunkerRebalancesTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+	}{
+		{"pre", []string{"<pre>"}},
+		{"code", []string{"<code>"}},
+		{"bold around code", []string{"<b>", `<code class="language-text">`}},
+		{"pre around bold", []string{"<pre>", "<b>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg strings.Builder
+			msg.WriteString("Report\n")
+			for _, tag := range tt.tags {
+				msg.WriteString(tag)
+			}
+			for i := range 100 {
+				fmt.Fprintf(&msg, "line %03d with some text\n", i)
+			}
+			for i := len(tt.tags) - 1; i >= 0; i-- {
+				name := tagRe.FindStringSubmatch(tt.tags[i])[2]
+				msg.WriteString("</" + name + ">")
+			}
+
+			parts := Chunker{Limit: 300, HTML: true}.Split(msg.String())
+			if len(parts) < 3 {
+				t.Fatalf("Split returned %d parts, want several", len(parts))
+			}
+			for i, p := range parts {
+				body := stripPartHeader(t, p, i, len(parts))
+				checkTags(t, body)
+				if i > 0 && !strings.HasPrefix(body, strings.Join(tt.tags, "")) {
+					t.Errorf("part %d does not reopen %v: %.40q", i+1, tt.tags, body)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkerNeverCutsTagsOrEntities(t *testing.T) {
+	// a single line with no break points forces cuts inside it
+	line := strings.Repeat(`<a href="https://example.com/x">x&amp;y</a> &lt;&#8594;&gt; `, 80)
+
+	for _, limit := range []int{60, 61, 67, 100, 333} {
+		parts := Chunker{Limit: limit, HTML: true}.Split(line)
+		if len(parts) < 2 {
+			t.Fatalf("limit %d: Split returned %d parts, want several", limit, len(parts))
+		}
+		var joined strings.Builder
+		for i, p := range parts {
+			if n := runeLen(p); n > limit {
+				t.Errorf("limit %d: part %d has %d runes", limit, i+1, n)
+			}
+			body := stripPartHeader(t, p, i, len(parts))
+			checkCuts(t, body)
+			checkTags(t, body)
+			joined.WriteString(stripTags(body))
+		}
+		if joined.String() != stripTags(line) {
+			t.Errorf("limit %d: parts joined do not give the message back", limit)
+		}
+	}
+}
+
+func TestChunkerNumbersParts(t *testing.T) {
+	msg := strings.Repeat("0123456789\n", 1200)
+	parts := Chunker{Limit: telegramMaxLen}.Split(msg)
+	if len(parts) != 4 {
+		t.Fatalf("Split returned %d parts, want 4", len(parts))
+	}
+	for i, p := range parts {
+		stripPartHeader(t, p, i, len(parts))
+	}
+
+	// 12 parts need two-digit numbers, still inside the reserved header room
+	parts = Chunker{Limit: 120}.Split(strings.Repeat("0123456789\n", 100))
+	if len(parts) < 10 {
+		t.Fatalf("Split returned %d parts, want at least 10", len(parts))
+	}
+	for i, p := range parts {
+		stripPartHeader(t, p, i, len(parts))
+		if n := runeLen(p); n > 120 {
+			t.Errorf("part %d has %d runes", i+1, n)
+		}
+	}
+}
@@ -1,49 +1,341 @@
 package notifier
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
 	"go.uber.org/zap"
 )
 
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+)
+
+const smtpTimeout = time.Minute
+
 type EmailNotifier struct {
-	host     string
-	port     int
-	user     string
-	password string
-	from     string
-	log      *zap.SugaredLogger
+	cfg config.SMTPConfig
+	log *zap.SugaredLogger
 }
 
-func NewEmailNotifier(host string, port int, user, password, from string, log *zap.SugaredLogger) *EmailNotifier {
-	return &EmailNotifier{
-		host:     host,
-		port:     port,
-		user:     user,
-		password: password,
-		from:     from,
-		log:      log,
-	}
+// Message is a single email; Text and HTML are sent as multipart/alternative.
+// With attachments the alternative part is wrapped into multipart/mixed.
+type Message struct {
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
 }
 
-func (e *EmailNotifier) Send(to, subject, body string) error {
-	addr := fmt.Sprintf("%s:%d", e.host, e.port)
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
 
-	auth := smtp.PlainAuth("", e.user, e.password, e.host)
+func NewEmailNotifier(cfg config.SMTPConfig, log *zap.SugaredLogger) *EmailNotifier {
+	if cfg.TLS == "" {
+		cfg.TLS = TLSStartTLS
+	}
+	return &EmailNotifier{cfg: cfg, log: log}
+}
 
-	headers := fmt.Sprintf(
-		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n",
-		e.from, to, subject,
-	)
+func (e *EmailNotifier) Send(msg Message) error {
+	from, err := mail.ParseAddress(e.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %w", e.cfg.From, err)
+	}
 
-	msg := []byte(headers + body)
+	to, err := parseAddresses(e.cfg.To)
+	if err != nil {
+		return fmt.Errorf("invalid to: %w", err)
+	}
+	cc, err := parseAddresses(e.cfg.Cc)
+	if err != nil {
+		return fmt.Errorf("invalid cc: %w", err)
+	}
+	bcc, err := parseAddresses(e.cfg.Bcc)
+	if err != nil {
+		return fmt.Errorf("invalid bcc: %w", err)
+	}
+
+	var rcpts []string
+	for _, list := range [][]*mail.Address{to, cc, bcc} {
+		for _, a := range list {
+			rcpts = append(rcpts, a.Address)
+		}
+	}
+	if len(rcpts) == 0 {
+		return fmt.Errorf("no recipients configured")
+	}
 
-	err := smtp.SendMail(addr, auth, e.from, []string{to}, msg)
+	body, err := buildMessage(from, to, cc, msg)
 	if err != nil {
+		return fmt.Errorf("build message: %w", err)
+	}
+
+	if err := e.deliver(from.Address, rcpts, body); err != nil {
 		return fmt.Errorf("send email failed: %w", err)
 	}
 
-	e.log.Infof("Email sent to %s", to)
+	e.log.Infof("Email sent to %d recipients", len(rcpts))
 	return nil
 }
+
+// Deliver sends a stored Message, prepending notice if not empty.
+func (e *EmailNotifier) Deliver(payload []byte, notice string) error {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("decode email payload: %w", err)
+	}
+
+	if notice != "" {
+		msg.Text = notice + "\n" + msg.Text
+		msg.HTML = "<pre><b>" + html.EscapeString(notice) + "</b></pre>" + msg.HTML
+	}
+
+	return e.Send(msg)
+}
+
+func (e *EmailNotifier) deliver(from string, rcpts []string, body []byte) error {
+	addr := net.JoinHostPort(e.cfg.Host, fmt.Sprintf("%d", e.cfg.Port))
+	tlsCfg := &tls.Config{ServerName: e.cfg.Host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch e.cfg.TLS {
+	case TLSImplicit:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsCfg)
+	case TLSStartTLS, TLSNone:
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("unknown tls mode %q", e.cfg.TLS)
+	}
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer c.Close()
+
+	if hostname, err := os.Hostname(); err == nil {
+		if err := c.Hello(hostname); err != nil {
+			return fmt.Errorf("ehlo: %w", err)
+		}
+	}
+
+	if e.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsCfg); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if e.cfg.User != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("server does not support AUTH, credentials would not be used")
+		}
+		if err := c.Auth(smtp.PlainAuth("", e.cfg.User, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+	for _, r := range rcpts {
+		if err := c.Rcpt(r); err != nil {
+			return fmt.Errorf("rcpt to %s: %w", r, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("write body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close body: %w", err)
+	}
+
+	return c.Quit()
+}
+
+func buildMessage(from *mail.Address, to, cc []*mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	mw := multipart.NewWriter(&buf)
+
+	h := func(k, v string) {
+		buf.WriteString(k + ": " + v + "\r\n")
+	}
+	h("From", from.String())
+	if len(to) > 0 {
+		h("To", joinAddresses(to))
+	} else {
+		// all recipients are in Bcc
+		h("To", "undisclosed-recipients:;")
+	}
+	if len(cc) > 0 {
+		h("Cc", joinAddresses(cc))
+	}
+	h("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	h("Date", time.Now().Format(time.RFC1123Z))
+	h("Message-ID", messageID(from.Address))
+	h("MIME-Version", "1.0")
+
+	if len(msg.Attachments) == 0 {
+		h("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+		buf.WriteString("\r\n")
+		if err := writeAlternative(mw, msg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	h("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	var alt bytes.Buffer
+	aw := multipart.NewWriter(&alt)
+	if err := writeAlternative(aw, msg); err != nil {
+		return nil, err
+	}
+
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + aw.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pw.Write(alt.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		if err := writeAttachment(mw, a); err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", a.Name, err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeAlternative(mw *multipart.Writer, msg Message) error {
+	if err := writeQPPart(mw, "text/plain; charset=UTF-8", msg.Text); err != nil {
+		return err
+	}
+	if err := writeQPPart(mw, "text/html; charset=UTF-8", msg.HTML); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": a.Name})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+
+	// RFC 2045 limits base64 lines to 76 characters
+	encoded := base64.StdEncoding.EncodeToString(a.Data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(pw, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(pw, encoded+"\r\n")
+	return err
+}
+
+func writeQPPart(mw *multipart.Writer, contentType, body string) error {
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(pw)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func parseAddresses(list []string) ([]*mail.Address, error) {
+	var out []*mail.Address
+	for _, s := range list {
+		a, err := mail.ParseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", s, err)
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func joinAddresses(list []*mail.Address) string {
+	parts := make([]string, len(list))
+	for i, a := range list {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from, "@"); ok {
+		domain = d
+	}
+
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
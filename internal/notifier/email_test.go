@@ -0,0 +1,280 @@
+package notifier
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"go.uber.org/zap"
+)
+
+// fakeSMTP is a minimal SMTP server that accepts one session and records
+// its envelope and data.
+type fakeSMTP struct {
+	addr *net.TCPAddr
+	auth bool
+
+	from   string
+	rcpts  []string
+	authed bool
+	data   string
+	done   chan struct{}
+}
+
+func startFakeSMTP(t *testing.T, auth bool) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeSMTP{addr: ln.Addr().(*net.TCPAddr), auth: auth, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(c *textproto.Conn) {
+	_ = c.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if s.auth {
+				_ = c.PrintfLine("250-fake")
+				_ = c.PrintfLine("250 AUTH PLAIN")
+			} else {
+				_ = c.PrintfLine("250 fake")
+			}
+		case "AUTH":
+			s.authed = true
+			_ = c.PrintfLine("235 ok")
+		case "MAIL":
+			s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			_ = c.PrintfLine("250 ok")
+		case "RCPT":
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			_ = c.PrintfLine("250 ok")
+		case "DATA":
+			_ = c.PrintfLine("354 go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			_ = c.PrintfLine("250 ok")
+		case "QUIT":
+			_ = c.PrintfLine("221 bye")
+			return
+		default:
+			_ = c.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func testSMTPConfig(s *fakeSMTP) config.SMTPConfig {
+	return config.SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     s.addr.Port,
+		User:     "alerts",
+		Password: "secret",
+		From:     "PSAS <alerts@example.com>",
+		TLS:      TLSNone,
+		To:       config.AddressList{"soc@example.com"},
+		Cc:       config.AddressList{"Network Ops <noc@example.com>"},
+		Bcc:      config.AddressList{"audit@example.com"},
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	s := startFakeSMTP(t, true)
+	e := NewEmailNotifier(testSMTPConfig(s), zap.NewNop().Sugar())
+
+	msg := Message{
+		Subject: "Изменения портов: 2 new",
+		Text:    "NEW 10.0.0.1:22\nNEW 10.0.0.2:443",
+		HTML:    "<b>NEW</b> 10.0.0.1:22",
+	}
+	if err := e.Send(msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	<-s.done
+
+	if !s.authed {
+		t.Error("client did not authenticate")
+	}
+	if s.from != "alerts@example.com" {
+		t.Errorf("MAIL FROM = %q, want alerts@example.com", s.from)
+	}
+	wantRcpts := []string{"soc@example.com", "noc@example.com", "audit@example.com"}
+	if !slices.Equal(s.rcpts, wantRcpts) {
+		t.Errorf("RCPT TO = %v, want %v", s.rcpts, wantRcpts)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(s.data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+
+	subject := m.Header.Get("Subject")
+	if !strings.HasPrefix(subject, "=?utf-8?q?") {
+		t.Errorf("Subject %q is not RFC 2047 encoded", subject)
+	}
+	if got, err := new(mime.WordDecoder).DecodeHeader(subject); err != nil || got != msg.Subject {
+		t.Errorf("decoded Subject = %q, %v, want %q", got, err, msg.Subject)
+	}
+	if _, err := m.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if id := m.Header.Get("Message-ID"); !regexp.MustCompile(`^<[^@<>]+@example\.com>$`).MatchString(id) {
+		t.Errorf("Message-ID = %q", id)
+	}
+	if v := m.Header.Get("MIME-Version"); v != "1.0" {
+		t.Errorf("MIME-Version = %q, want 1.0", v)
+	}
+	if to := m.Header.Get("To"); to != "<soc@example.com>" {
+		t.Errorf("To = %q", to)
+	}
+	if cc := m.Header.Get("Cc"); cc != `"Network Ops" <noc@example.com>` {
+		t.Errorf("Cc = %q", cc)
+	}
+	if bcc := m.Header.Get("Bcc"); bcc != "" || strings.Contains(s.data, "audit@example.com") {
+		t.Errorf("Bcc recipient leaked into the message: %q", bcc)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v, want multipart/alternative", mediaType, err)
+	}
+	parts := readParts(t, multipart.NewReader(m.Body, params["boundary"]))
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("got %d parts, want %d", len(parts), len(want))
+	}
+	for i, w := range want {
+		if parts[i].contentType != w.contentType || parts[i].body != w.body {
+			t.Errorf("part %d = %q %q, want %q %q", i, parts[i].contentType, parts[i].body, w.contentType, w.body)
+		}
+	}
+}
+
+func TestEmailSendAttachments(t *testing.T) {
+	s := startFakeSMTP(t, true)
+	e := NewEmailNotifier(testSMTPConfig(s), zap.NewNop().Sugar())
+
+	msg := Message{
+		Subject:     "Port changes",
+		Text:        "summary",
+		HTML:        "<p>summary</p>",
+		Attachments: []Attachment{{Name: "diff.csv", ContentType: "text/csv", Data: []byte("change,ip,port\nNEW,10.0.0.1,22\n")}},
+	}
+	if err := e.Send(msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	<-s.done
+
+	m, err := mail.ReadMessage(strings.NewReader(s.data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, %v, want multipart/mixed", mediaType, err)
+	}
+
+	parts := readParts(t, multipart.NewReader(m.Body, params["boundary"]))
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if !strings.HasPrefix(parts[0].contentType, "multipart/alternative") {
+		t.Errorf("first part is %q, want multipart/alternative", parts[0].contentType)
+	}
+	if parts[1].filename != "diff.csv" || parts[1].body != string(msg.Attachments[0].Data) {
+		t.Errorf("attachment = %q %q", parts[1].filename, parts[1].body)
+	}
+}
+
+func TestEmailSendRequiresAuth(t *testing.T) {
+	s := startFakeSMTP(t, false)
+	e := NewEmailNotifier(testSMTPConfig(s), zap.NewNop().Sugar())
+
+	err := e.Send(Message{Subject: "test", Text: "test"})
+	if err == nil || !strings.Contains(err.Error(), "AUTH") {
+		t.Fatalf("Send = %v, want an AUTH error", err)
+	}
+	<-s.done
+	if s.data != "" {
+		t.Error("message was sent without authentication")
+	}
+}
+
+func TestEmailSendWithoutUser(t *testing.T) {
+	s := startFakeSMTP(t, false)
+	cfg := testSMTPConfig(s)
+	cfg.User, cfg.Password = "", ""
+	e := NewEmailNotifier(cfg, zap.NewNop().Sugar())
+
+	if err := e.Send(Message{Subject: "test", Text: "test"}); err != nil {
+		t.Fatalf("Send to a relay without AUTH: %v", err)
+	}
+	<-s.done
+	if s.authed || s.data == "" {
+		t.Errorf("authed = %v, data sent = %v, want no AUTH and a message", s.authed, s.data != "")
+	}
+}
+
+type part struct {
+	contentType string
+	filename    string
+	body        string
+}
+
+func readParts(t *testing.T, r *multipart.Reader) []part {
+	t.Helper()
+	var out []part
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		// attachments are base64, which multipart.Reader leaves encoded
+		if p.Header.Get("Content-Transfer-Encoding") == "base64" {
+			body, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+			if err != nil {
+				t.Fatalf("decode part: %v", err)
+			}
+		}
+		out = append(out, part{contentType: p.Header.Get("Content-Type"), filename: p.FileName(), body: string(body)})
+	}
+}
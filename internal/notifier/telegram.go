@@ -1,10 +1,16 @@
 package notifier
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -12,6 +18,8 @@ import (
 type TelegramNotifier struct {
 	token  string
 	chatID int64
+	api    string
+	client *http.Client
 	log    *zap.SugaredLogger
 }
 
@@ -19,42 +27,191 @@ func NewTelegramNotifier(token string, chatID int64, log *zap.SugaredLogger) *Te
 	return &TelegramNotifier{
 		token:  token,
 		chatID: chatID,
+		api:    "https://api.telegram.org",
+		// must outlive the getUpdates long-polling timeout
+		client: &http.Client{Timeout: 2 * telegramPollTimeout},
 		log:    log,
 	}
 }
 
 const telegramMaxLen = 4096
 
-func (t *TelegramNotifier) Send(message string) error {
-	runes := []rune(message)
-	for i := 0; i < len(runes); i += telegramMaxLen {
-		end := i + telegramMaxLen
-		if end > len(runes) {
-			end = len(runes)
+// ackMarkup is an inline "Acknowledge" button; pressing it calls
+// BotHandlers.Ack.
+func ackMarkup(alertID int64) (string, error) {
+	markup, err := json.Marshal(inlineKeyboard{
+		InlineKeyboard: [][]inlineButton{{
+			{Text: "Acknowledge", CallbackData: fmt.Sprintf("%s%d", ackPrefix, alertID)},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshal reply markup: %w", err)
+	}
+	return string(markup), nil
+}
+
+// TelegramPayload is the outbox representation of a Telegram alert. Once a
+// long message was partly delivered, Parts holds its chunks and Sent the
+// number of them already sent.
+type TelegramPayload struct {
+	Text    string   `json:"text"`
+	AlertID int64    `json:"alert_id,omitempty"`
+	Parts   []string `json:"parts,omitempty"`
+	Sent    int      `json:"sent,omitempty"`
+}
+
+// PartialError means some parts of a message were sent before Err; Payload
+// records them so that the next attempt sends only the rest.
+type PartialError struct {
+	Err     error
+	payload []byte
+}
+
+func (e *PartialError) Error() string   { return e.Err.Error() }
+func (e *PartialError) Unwrap() error   { return e.Err }
+func (e *PartialError) Payload() []byte { return e.payload }
+
+// Deliver sends a stored TelegramPayload, prepending notice if not empty.
+// A partly delivered payload resumes at its first unsent part, after the
+// notice sent as a message of its own.
+func (t *TelegramNotifier) Deliver(payload []byte, notice string) error {
+	var p TelegramPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("decode telegram payload: %w", err)
+	}
+
+	notice = noticeHTML(notice)
+	parts := p.Parts
+	if len(parts) == 0 {
+		parts = splitMessage(notice + p.Text)
+	} else if notice != "" {
+		// the remaining parts were split before the notice existed
+		if err := t.send(t.chatID, notice, ""); err != nil {
+			return err
 		}
-		if err := t.sendChunk(string(runes[i:end])); err != nil {
+	}
+
+	markup := ""
+	if p.AlertID != 0 {
+		var err error
+		if markup, err = ackMarkup(p.AlertID); err != nil {
 			return err
 		}
 	}
+
+	sent, err := t.sendParts(t.chatID, parts, p.Sent, markup)
+	if err == nil || sent == p.Sent {
+		return err
+	}
+
+	p.Parts, p.Sent = parts, sent
+	data, mErr := json.Marshal(p)
+	if mErr != nil {
+		return err
+	}
+	t.log.Warnf("Telegram message sent in part (%d of %d parts)", sent, len(parts))
+	return &PartialError{Err: err, payload: data}
+}
+
+func noticeHTML(notice string) string {
+	if notice == "" {
+		return ""
+	}
+	return "<b>" + html.EscapeString(notice) + "</b>\n"
+}
+
+func splitMessage(message string) []string {
+	chunker := Chunker{Limit: telegramMaxLen, HTML: true}
+	return chunker.Split(message)
+}
+
+func (t *TelegramNotifier) send(chatID int64, message, markup string) error {
+	_, err := t.sendParts(chatID, splitMessage(message), 0, markup)
+	return err
+}
+
+// sendParts sends parts starting at from, with markup on the last one, and
+// returns the number of parts sent.
+func (t *TelegramNotifier) sendParts(chatID int64, parts []string, from int, markup string) (int, error) {
+	for i := from; i < len(parts); i++ {
+		m := ""
+		if i == len(parts)-1 {
+			m = markup
+		}
+		if err := t.sendHTML(chatID, parts[i], m); err != nil {
+			return i, err
+		}
+	}
+	return len(parts), nil
+}
+
+// errParseEntities is returned when Telegram rejects the HTML markup.
+var errParseEntities = errors.New("telegram can't parse entities")
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// sendHTML sends the chunk as HTML and falls back to plain text
+// if Telegram fails to parse the markup.
+func (t *TelegramNotifier) sendHTML(chatID int64, text, markup string) error {
+	err := t.sendChunk(chatID, text, "HTML", markup)
+	if !errors.Is(err, errParseEntities) {
+		return err
+	}
+
+	t.log.Warnf("Telegram rejected HTML, resending as plain text: %v", err)
+	return t.sendChunk(chatID, toPlainText(text), "", markup)
+}
+
+// toPlainText strips HTML tags and unescapes entities.
+func toPlainText(text string) string {
+	return html.UnescapeString(htmlTagRe.ReplaceAllString(text, ""))
+}
+
+func (t *TelegramNotifier) sendChunk(chatID int64, text, parseMode, markup string) error {
+	values := url.Values{
+		"chat_id": {fmt.Sprintf("%d", chatID)},
+		"text":    {text},
+	}
+	if parseMode != "" {
+		values.Set("parse_mode", parseMode)
+	}
+	if markup != "" {
+		values.Set("reply_markup", markup)
+	}
+
+	if err := t.call("sendMessage", values, nil); err != nil {
+		return err
+	}
+
+	t.log.Info("Telegram notification sent")
 	return nil
 }
 
-func (t *TelegramNotifier) sendChunk(text string) error {
-	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", t.token)
+// call invokes a Bot API method and decodes its result into out (if not nil).
+func (t *TelegramNotifier) call(method string, values url.Values, out any) error {
+	return t.callContext(context.Background(), method, values, out)
+}
+
+// callContext is call that gives up when ctx is done.
+func (t *TelegramNotifier) callContext(ctx context.Context, method string, values url.Values, out any) error {
+	apiURL := fmt.Sprintf("%s/bot%s/%s", t.api, t.token, method)
 
-	resp, err := http.PostForm(apiURL, url.Values{
-		"chat_id":    {fmt.Sprintf("%d", t.chatID)},
-		"text":       {text},
-		"parse_mode": {"HTML"},
-	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, strings.NewReader(values.Encode()))
 	if err != nil {
-		return fmt.Errorf("telegram request failed: %w", err)
+		return fmt.Errorf("telegram request failed: %w", redactToken(err, t.token))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("telegram request failed: %w", redactToken(err, t.token))
 	}
 	defer resp.Body.Close()
 
 	var result struct {
-		OK          bool   `json:"ok"`
-		Description string `json:"description"`
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
@@ -62,9 +219,26 @@ func (t *TelegramNotifier) sendChunk(text string) error {
 	}
 
 	if !result.OK {
+		if strings.Contains(result.Description, "can't parse entities") {
+			return fmt.Errorf("%w: %s", errParseEntities, result.Description)
+		}
 		return fmt.Errorf("telegram API error: %s", result.Description)
 	}
 
-	t.log.Info("Telegram notification sent")
+	if out != nil {
+		if err := json.Unmarshal(result.Result, out); err != nil {
+			return fmt.Errorf("telegram result parse failed: %w", err)
+		}
+	}
 	return nil
 }
+
+// redactToken hides the bot token that net/http includes in URL errors.
+func redactToken(err error, token string) error {
+	if token == "" || !strings.Contains(err.Error(), token) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), token, "<token>"))
+}
+
+const telegramPollTimeout = 30 * time.Second
@@ -0,0 +1,223 @@
+package notifier
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ackPrefix = "ack:"
+
+// BotHandlers are the callbacks the Telegram bot uses to answer commands.
+// Every handler returns an HTML reply.
+type BotHandlers struct {
+	// Status describes the last run (/status).
+	Status func() string
+	// Scan triggers an immediate run of a job, or all jobs if empty (/scan [job]).
+	Scan func(job string) string
+	// Host lists open ports of a single host (/host <ip>).
+	Host func(ip string) string
+	// Ack records an acknowledgement of an alert (inline button).
+	Ack func(alertID int64, by string) string
+}
+
+type inlineKeyboard struct {
+	InlineKeyboard [][]inlineButton `json:"inline_keyboard"`
+}
+
+type inlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+type telegramUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"first_name"`
+}
+
+func (u telegramUser) String() string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	return strconv.FormatInt(u.ID, 10)
+}
+
+type telegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *telegramUser `json:"from"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+type telegramUpdate struct {
+	UpdateID      int64            `json:"update_id"`
+	Message       *telegramMessage `json:"message"`
+	CallbackQuery *struct {
+		ID      string           `json:"id"`
+		From    telegramUser     `json:"from"`
+		Message *telegramMessage `json:"message"`
+		Data    string           `json:"data"`
+	} `json:"callback_query"`
+}
+
+// RunBot long-polls Telegram for commands and button presses until ctx is
+// done, starting at update offset (0 for the first unconfirmed one). It
+// confirms the handled updates before returning and returns the offset to
+// continue from. Only chats listed in allowed (and the notifier's own chat)
+// are served.
+func (t *TelegramNotifier) RunBot(ctx context.Context, offset int64, allowed []int64, h BotHandlers) int64 {
+	chats := map[int64]bool{t.chatID: true}
+	for _, id := range allowed {
+		chats[id] = true
+	}
+
+	t.log.Infof("Telegram bot started, %d allowed chats", len(chats))
+
+	for {
+		if ctx.Err() != nil {
+			t.confirmUpdates(offset)
+			t.log.Info("Telegram bot stopped")
+			return offset
+		}
+
+		var updates []telegramUpdate
+		err := t.callContext(ctx, "getUpdates", url.Values{
+			"offset":          {strconv.FormatInt(offset, 10)},
+			"timeout":         {strconv.Itoa(int(telegramPollTimeout.Seconds()))},
+			"allowed_updates": {`["message","callback_query"]`},
+		}, &updates)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			t.log.Errorf("Telegram getUpdates failed: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			t.handleUpdate(u, chats, h)
+		}
+	}
+}
+
+// confirmUpdates tells Telegram that updates before offset were handled, so
+// that they are not delivered again to the next bot.
+func (t *TelegramNotifier) confirmUpdates(offset int64) {
+	if offset == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var updates []telegramUpdate
+	if err := t.callContext(ctx, "getUpdates", url.Values{
+		"offset":  {strconv.FormatInt(offset, 10)},
+		"limit":   {"1"},
+		"timeout": {"0"},
+	}, &updates); err != nil {
+		t.log.Warnf("Telegram confirm updates failed: %v", err)
+	}
+}
+
+func (t *TelegramNotifier) handleUpdate(u telegramUpdate, chats map[int64]bool, h BotHandlers) {
+	if q := u.CallbackQuery; q != nil {
+		if q.Message == nil || !chats[q.Message.Chat.ID] {
+			t.log.Warnf("Telegram callback from unauthorized user %s", q.From)
+			t.answerCallback(q.ID, "Not allowed")
+			return
+		}
+		t.handleCallback(q.ID, q.Data, q.From.String(), q.Message, h)
+		return
+	}
+
+	m := u.Message
+	if m == nil || !strings.HasPrefix(m.Text, "/") {
+		return
+	}
+
+	if !chats[m.Chat.ID] {
+		t.log.Warnf("Telegram command from unauthorized chat %d", m.Chat.ID)
+		return
+	}
+
+	fields := strings.Fields(m.Text)
+	// commands in groups come as /cmd@botname
+	cmd, _, _ := strings.Cut(fields[0], "@")
+	args := fields[1:]
+
+	var reply string
+	switch {
+	case cmd == "/status" && h.Status != nil:
+		reply = h.Status()
+	case cmd == "/scan" && h.Scan != nil:
+		job := ""
+		if len(args) > 0 {
+			job = args[0]
+		}
+		reply = h.Scan(job)
+	case cmd == "/host" && h.Host != nil:
+		if len(args) != 1 {
+			reply = "Usage: /host &lt;ip&gt;"
+		} else {
+			reply = h.Host(args[0])
+		}
+	default:
+		reply = "Commands: /status, /scan [job], /host &lt;ip&gt;"
+	}
+
+	if err := t.send(m.Chat.ID, reply, ""); err != nil {
+		t.log.Errorf("Telegram reply failed: %v", err)
+	}
+}
+
+func (t *TelegramNotifier) handleCallback(id, data, by string, msg *telegramMessage, h BotHandlers) {
+	idStr, ok := strings.CutPrefix(data, ackPrefix)
+	if !ok || h.Ack == nil {
+		t.answerCallback(id, "Unknown action")
+		return
+	}
+
+	alertID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		t.answerCallback(id, "Invalid alert")
+		return
+	}
+
+	reply := h.Ack(alertID, by)
+	t.answerCallback(id, toPlainText(reply))
+
+	// drop the button so the alert is not acknowledged twice
+	if err := t.call("editMessageReplyMarkup", url.Values{
+		"chat_id":      {strconv.FormatInt(msg.Chat.ID, 10)},
+		"message_id":   {strconv.FormatInt(msg.MessageID, 10)},
+		"reply_markup": {`{"inline_keyboard":[]}`},
+	}, nil); err != nil {
+		t.log.Warnf("Telegram edit markup failed: %v", err)
+	}
+
+	if err := t.send(msg.Chat.ID, reply, ""); err != nil {
+		t.log.Errorf("Telegram reply failed: %v", err)
+	}
+}
+
+func (t *TelegramNotifier) answerCallback(id, text string) {
+	if err := t.call("answerCallbackQuery", url.Values{
+		"callback_query_id": {id},
+		"text":              {text},
+	}, nil); err != nil {
+		t.log.Warnf("Telegram answerCallbackQuery failed: %v", err)
+	}
+}
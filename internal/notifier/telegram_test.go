@@ -0,0 +1,164 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestTelegramDeliverResumesParts(t *testing.T) {
+	var (
+		texts  []string
+		failAt = 2 // the third sendMessage fails once
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(texts) == failAt {
+			failAt = -1
+			fmt.Fprint(w, `{"ok":false,"description":"Too Many Requests"}`)
+			return
+		}
+		texts = append(texts, r.FormValue("text"))
+		fmt.Fprint(w, `{"ok":true,"result":{}}`)
+	}))
+	defer srv.Close()
+
+	tg := NewTelegramNotifier("token", 1, zap.NewNop().Sugar())
+	tg.api = srv.URL
+
+	var lines []string
+	for i := range 400 {
+		lines = append(lines, fmt.Sprintf("NEW 10.0.%d.%d:443 tcp https", i/256, i%256))
+	}
+	payload, _ := json.Marshal(TelegramPayload{Text: strings.Join(lines, "\n")})
+
+	err := tg.Deliver(payload, "")
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("Deliver = %v, want a PartialError", err)
+	}
+
+	var p TelegramPayload
+	if err := json.Unmarshal(partial.Payload(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Sent != 2 || len(p.Parts) <= p.Sent {
+		t.Fatalf("payload has %d of %d parts sent, want 2", p.Sent, len(p.Parts))
+	}
+
+	// the notice of a retry goes out on its own, the remaining parts as split
+	if err := tg.Deliver(partial.Payload(), "WARNING: earlier failure"); err != nil {
+		t.Fatalf("resumed Deliver: %v", err)
+	}
+	want := slices.Concat(p.Parts[:2], []string{"<b>WARNING: earlier failure</b>\n"}, p.Parts[2:])
+	if len(texts) != len(want) {
+		t.Fatalf("sent %d messages, want %d", len(texts), len(want))
+	}
+	for i, text := range texts {
+		if text != want[i] {
+			t.Errorf("message %d = %.40q, want %.40q", i, text, want[i])
+		}
+	}
+}
+
+func TestTelegramDeliverNoticeFailure(t *testing.T) {
+	var texts []string
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			fail = false
+			fmt.Fprint(w, `{"ok":false,"description":"Bad Gateway"}`)
+			return
+		}
+		texts = append(texts, r.FormValue("text"))
+		fmt.Fprint(w, `{"ok":true,"result":{}}`)
+	}))
+	defer srv.Close()
+
+	tg := NewTelegramNotifier("token", 1, zap.NewNop().Sugar())
+	tg.api = srv.URL
+
+	payload, _ := json.Marshal(TelegramPayload{Parts: []string{"(1/2)\none", "(2/2)\ntwo"}, Sent: 1})
+	err := tg.Deliver(payload, "WARNING: earlier failure")
+	var partial *PartialError
+	if err == nil || errors.As(err, &partial) {
+		t.Fatalf("Deliver with a failing notice = %v, want a plain error", err)
+	}
+	if len(texts) != 0 {
+		t.Errorf("parts were sent after the notice failed: %q", texts)
+	}
+}
+
+func TestRunBotStopsAndConfirms(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		offsets []string
+		served  bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/getUpdates") {
+			fmt.Fprint(w, `{"ok":true,"result":{}}`)
+			return
+		}
+		mu.Lock()
+		offsets = append(offsets, r.FormValue("offset"))
+		first := !served
+		served = true
+		mu.Unlock()
+
+		switch {
+		case first:
+			fmt.Fprint(w, `{"ok":true,"result":[{"update_id":41,"message":{"message_id":1,"chat":{"id":1},"text":"/status"}}]}`)
+		case r.FormValue("timeout") == "0":
+			fmt.Fprint(w, `{"ok":true,"result":[]}`)
+		default:
+			// long poll until the bot gives up
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	tg := NewTelegramNotifier("token", 1, zap.NewNop().Sugar())
+	tg.api = srv.URL
+
+	statusCalls := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int64)
+	go func() {
+		done <- tg.RunBot(ctx, 0, nil, BotHandlers{Status: func() string {
+			statusCalls <- struct{}{}
+			return "ok"
+		}})
+	}()
+
+	select {
+	case <-statusCalls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("/status was not handled")
+	}
+	cancel()
+
+	select {
+	case offset := <-done:
+		if offset != 42 {
+			t.Errorf("RunBot returned offset %d, want 42", offset)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunBot did not stop while long polling")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if last := offsets[len(offsets)-1]; last != "42" {
+		t.Errorf("last getUpdates offset = %s, want 42 to confirm the handled update", last)
+	}
+}
@@ -0,0 +1,208 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"go.uber.org/zap"
+)
+
+// Sender delivers a stored payload. notice is a plain-text warning about
+// earlier failed deliveries that should be prepended to the message.
+type Sender interface {
+	Deliver(payload []byte, notice string) error
+}
+
+// partialError is returned by a Sender that delivered part of a payload;
+// Payload replaces the stored one so that a retry resumes where it stopped.
+type partialError interface {
+	error
+	Payload() []byte
+}
+
+type Store interface {
+	EnqueueOutbox(channel string, payload []byte) (int64, error)
+	DueOutbox(now time.Time) ([]model.OutboxEntry, error)
+	UnreportedFailures() ([]model.OutboxEntry, error)
+	MarkOutboxSent(id int64) error
+	MarkOutboxRetry(id int64, next time.Time, lastErr string) error
+	UpdateOutboxPayload(id int64, payload []byte) error
+	MarkOutboxFailed(id int64, lastErr string) error
+	MarkFailuresReported(ids []int64) error
+}
+
+type Options struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Outbox persists notifications before sending and retries failed
+// deliveries with exponential backoff, also across restarts.
+type Outbox struct {
+	store   Store
+	senders map[string]Sender
+	opts    Options
+	mu      sync.Mutex
+	log     *zap.SugaredLogger
+}
+
+func New(store Store, opts Options, log *zap.SugaredLogger) *Outbox {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 30 * time.Second
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = time.Hour
+	}
+
+	return &Outbox{
+		store:   store,
+		senders: make(map[string]Sender),
+		opts:    opts,
+		log:     log,
+	}
+}
+
+func (o *Outbox) Register(channel string, s Sender) {
+	o.senders[channel] = s
+}
+
+// Enqueue stores the payload (marshalled to JSON) for delivery via channel.
+func (o *Outbox) Enqueue(channel string, payload any) error {
+	if _, ok := o.senders[channel]; !ok {
+		return fmt.Errorf("unknown channel %q", channel)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s payload: %w", channel, err)
+	}
+
+	if _, err := o.store.EnqueueOutbox(channel, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Flush tries to deliver every due entry once.
+func (o *Outbox) Flush(ctx context.Context) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries, err := o.store.DueOutbox(time.Now())
+	if err != nil {
+		o.log.Errorf("Outbox load failed: %v", err)
+		return
+	}
+
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		o.deliver(e)
+	}
+}
+
+// Run flushes the outbox every interval until ctx is done.
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.Flush(ctx)
+		}
+	}
+}
+
+func (o *Outbox) deliver(e model.OutboxEntry) {
+	sender, ok := o.senders[e.Channel]
+	if !ok {
+		// channel was disabled since the entry was stored; keep it for later
+		return
+	}
+
+	failures, err := o.store.UnreportedFailures()
+	if err != nil {
+		o.log.Errorf("Outbox failures load failed: %v", err)
+	}
+
+	err = sender.Deliver(e.Payload, buildNotice(failures))
+	if err == nil {
+		if err := o.store.MarkOutboxSent(e.ID); err != nil {
+			o.log.Errorf("Outbox: %v", err)
+		}
+		if len(failures) > 0 {
+			ids := make([]int64, len(failures))
+			for i, f := range failures {
+				ids[i] = f.ID
+			}
+			if err := o.store.MarkFailuresReported(ids); err != nil {
+				o.log.Errorf("Outbox: %v", err)
+			}
+		}
+		return
+	}
+
+	var partial partialError
+	if errors.As(err, &partial) {
+		if err := o.store.UpdateOutboxPayload(e.ID, partial.Payload()); err != nil {
+			o.log.Errorf("Outbox: %v", err)
+		}
+	}
+
+	attempts := e.Attempts + 1
+	if attempts >= o.opts.MaxAttempts {
+		o.log.Errorf("Delivery #%d via %s failed permanently after %d attempts: %v",
+			e.ID, e.Channel, attempts, err)
+		if err := o.store.MarkOutboxFailed(e.ID, err.Error()); err != nil {
+			o.log.Errorf("Outbox: %v", err)
+		}
+		return
+	}
+
+	next := time.Now().Add(o.backoff(attempts))
+	o.log.Warnf("Delivery #%d via %s failed (attempt %d/%d), retry at %s: %v",
+		e.ID, e.Channel, attempts, o.opts.MaxAttempts, next.Format(time.DateTime), err)
+	if err := o.store.MarkOutboxRetry(e.ID, next, err.Error()); err != nil {
+		o.log.Errorf("Outbox: %v", err)
+	}
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	d := o.opts.BaseDelay
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= o.opts.MaxDelay {
+			return o.opts.MaxDelay
+		}
+	}
+	return d
+}
+
+func buildNotice(failures []model.OutboxEntry) string {
+	if len(failures) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf("WARNING: %d earlier notification(s) could not be delivered:\n", len(failures)))
+	for _, f := range failures {
+		b.WriteString(fmt.Sprintf("  #%d %s from %s after %d attempts: %s\n",
+			f.ID, f.Channel, f.CreatedAt.Format(time.DateTime), f.Attempts, f.LastError))
+	}
+	return b.String()
+}
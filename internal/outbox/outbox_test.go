@@ -0,0 +1,293 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+type fakeEntry struct {
+	model.OutboxEntry
+	status   string
+	reported bool
+}
+
+// fakeStore keeps the outbox in memory with the semantics of the sqlite one.
+type fakeStore struct {
+	entries []*fakeEntry
+}
+
+func (s *fakeStore) EnqueueOutbox(channel string, payload []byte) (int64, error) {
+	id := int64(len(s.entries) + 1)
+	now := time.Now()
+	s.entries = append(s.entries, &fakeEntry{
+		OutboxEntry: model.OutboxEntry{ID: id, Channel: channel, Payload: payload, NextAttempt: now, CreatedAt: now},
+		status:      "pending",
+	})
+	return id, nil
+}
+
+func (s *fakeStore) DueOutbox(now time.Time) ([]model.OutboxEntry, error) {
+	var out []model.OutboxEntry
+	for _, e := range s.entries {
+		if e.status == "pending" && !e.NextAttempt.After(now) {
+			out = append(out, e.OutboxEntry)
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) UnreportedFailures() ([]model.OutboxEntry, error) {
+	var out []model.OutboxEntry
+	for _, e := range s.entries {
+		if e.status == "failed" && !e.reported {
+			out = append(out, e.OutboxEntry)
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) MarkOutboxSent(id int64) error {
+	e := s.entries[id-1]
+	e.status = "sent"
+	e.Attempts++
+	return nil
+}
+
+func (s *fakeStore) MarkOutboxRetry(id int64, next time.Time, lastErr string) error {
+	e := s.entries[id-1]
+	e.Attempts++
+	e.NextAttempt, e.LastError = next, lastErr
+	return nil
+}
+
+func (s *fakeStore) UpdateOutboxPayload(id int64, payload []byte) error {
+	s.entries[id-1].Payload = payload
+	return nil
+}
+
+func (s *fakeStore) MarkOutboxFailed(id int64, lastErr string) error {
+	e := s.entries[id-1]
+	e.status = "failed"
+	e.Attempts++
+	e.LastError = lastErr
+	return nil
+}
+
+func (s *fakeStore) MarkFailuresReported(ids []int64) error {
+	for _, id := range ids {
+		s.entries[id-1].reported = true
+	}
+	return nil
+}
+
+// makeDue moves every pending retry to now.
+func (s *fakeStore) makeDue() {
+	for _, e := range s.entries {
+		e.NextAttempt = time.Now()
+	}
+}
+
+type delivery struct {
+	payload string
+	notice  string
+}
+
+type fakeSender struct {
+	fail       error
+	deliveries []delivery
+}
+
+func (f *fakeSender) Deliver(payload []byte, notice string) error {
+	f.deliveries = append(f.deliveries, delivery{string(payload), notice})
+	return f.fail
+}
+
+type partial struct{ payload []byte }
+
+func (p *partial) Error() string   { return "sent in part" }
+func (p *partial) Payload() []byte { return p.payload }
+
+func newTestOutbox(opts Options) (*Outbox, *fakeStore) {
+	store := &fakeStore{}
+	return New(store, opts, zap.NewNop().Sugar()), store
+}
+
+func TestBackoff(t *testing.T) {
+	o, _ := newTestOutbox(Options{BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute})
+
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if got := o.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	o, _ := newTestOutbox(Options{})
+	if o.opts.MaxAttempts != 10 || o.opts.BaseDelay != 30*time.Second || o.opts.MaxDelay != time.Hour {
+		t.Errorf("default options = %+v", o.opts)
+	}
+}
+
+func TestEnqueueUnknownChannel(t *testing.T) {
+	o, store := newTestOutbox(Options{})
+	if err := o.Enqueue("email", "text"); err == nil {
+		t.Error("Enqueue to an unregistered channel succeeded")
+	}
+	if len(store.entries) != 0 {
+		t.Errorf("stored %d entries", len(store.entries))
+	}
+}
+
+func TestFlushRetriesWithBackoff(t *testing.T) {
+	o, store := newTestOutbox(Options{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour})
+	sender := &fakeSender{fail: errors.New("connection refused")}
+	o.Register("email", sender)
+	ctx := context.Background()
+
+	if err := o.Enqueue("email", "alert"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	o.Flush(ctx)
+	e := store.entries[0]
+	if e.Attempts != 1 || e.status != "pending" || e.LastError != "connection refused" {
+		t.Fatalf("after one failure: attempts %d, status %s, error %q", e.Attempts, e.status, e.LastError)
+	}
+	if d := e.NextAttempt.Sub(start); d < time.Minute || d > time.Minute+5*time.Second {
+		t.Errorf("first retry in %s, want 1m", d)
+	}
+
+	// not due yet
+	o.Flush(ctx)
+	if len(sender.deliveries) != 1 {
+		t.Fatalf("delivered %d times before the retry was due", len(sender.deliveries))
+	}
+
+	store.makeDue()
+	start = time.Now()
+	o.Flush(ctx)
+	if d := e.NextAttempt.Sub(start); e.Attempts != 2 || d < 2*time.Minute || d > 2*time.Minute+5*time.Second {
+		t.Errorf("second retry: attempts %d, in %s, want 2 and 2m", e.Attempts, d)
+	}
+
+	store.makeDue()
+	o.Flush(ctx)
+	if e.Attempts != 3 || e.status != "failed" {
+		t.Fatalf("after max attempts: attempts %d, status %s, want 3 failed", e.Attempts, e.status)
+	}
+
+	store.makeDue()
+	o.Flush(ctx)
+	if len(sender.deliveries) != 3 {
+		t.Errorf("failed entry delivered again, %d deliveries", len(sender.deliveries))
+	}
+}
+
+func TestFlushReportsFailures(t *testing.T) {
+	o, store := newTestOutbox(Options{MaxAttempts: 1})
+	broken := &fakeSender{fail: errors.New("401 unauthorized")}
+	working := &fakeSender{}
+	o.Register("telegram", broken)
+	o.Register("email", working)
+	ctx := context.Background()
+
+	if err := o.Enqueue("telegram", "lost"); err != nil {
+		t.Fatal(err)
+	}
+	o.Flush(ctx)
+	if store.entries[0].status != "failed" {
+		t.Fatalf("entry status %s, want failed", store.entries[0].status)
+	}
+
+	if err := o.Enqueue("email", "next"); err != nil {
+		t.Fatal(err)
+	}
+	o.Flush(ctx)
+	if len(working.deliveries) != 1 {
+		t.Fatalf("email delivered %d times", len(working.deliveries))
+	}
+	notice := working.deliveries[0].notice
+	if !strings.Contains(notice, "1 earlier notification") || !strings.Contains(notice, "#1 telegram") ||
+		!strings.Contains(notice, "401 unauthorized") {
+		t.Errorf("notice = %q", notice)
+	}
+	if !store.entries[0].reported {
+		t.Error("failure not marked reported after a successful delivery")
+	}
+
+	if err := o.Enqueue("email", "later"); err != nil {
+		t.Fatal(err)
+	}
+	o.Flush(ctx)
+	if notice := working.deliveries[1].notice; notice != "" {
+		t.Errorf("failure reported twice: %q", notice)
+	}
+}
+
+func TestFlushKeepsFailuresOfFailedDelivery(t *testing.T) {
+	o, store := newTestOutbox(Options{MaxAttempts: 1})
+	o.Register("telegram", &fakeSender{fail: errors.New("down")})
+	ctx := context.Background()
+
+	for range 2 {
+		if err := o.Enqueue("telegram", "alert"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o.Flush(ctx)
+	for _, e := range store.entries {
+		if e.status != "failed" || e.reported {
+			t.Errorf("entry #%d: status %s, reported %v, want failed and unreported", e.ID, e.status, e.reported)
+		}
+	}
+}
+
+func TestFlushStoresPartialPayload(t *testing.T) {
+	o, store := newTestOutbox(Options{MaxAttempts: 5})
+	sender := &fakeSender{fail: &partial{payload: []byte(`{"sent":2}`)}}
+	o.Register("telegram", sender)
+
+	if err := o.Enqueue("telegram", "long"); err != nil {
+		t.Fatal(err)
+	}
+	o.Flush(context.Background())
+
+	e := store.entries[0]
+	if string(e.Payload) != `{"sent":2}` || e.Attempts != 1 || e.status != "pending" {
+		t.Errorf("after partial delivery: payload %s, attempts %d, status %s", e.Payload, e.Attempts, e.status)
+	}
+
+	sender.fail = nil
+	store.makeDue()
+	o.Flush(context.Background())
+	if got := sender.deliveries[1].payload; got != `{"sent":2}` {
+		t.Errorf("retry delivered %s, want the updated payload", got)
+	}
+	if e.status != "sent" {
+		t.Errorf("status %s, want sent", e.status)
+	}
+}
+
+func TestFlushKeepsUnregisteredChannel(t *testing.T) {
+	o, store := newTestOutbox(Options{})
+	o.Register("email", &fakeSender{})
+	if err := o.Enqueue("email", "alert"); err != nil {
+		t.Fatal(err)
+	}
+	delete(o.senders, "email")
+
+	o.Flush(context.Background())
+	if e := store.entries[0]; e.status != "pending" || e.Attempts != 0 {
+		t.Errorf("entry of a disabled channel: status %s, attempts %d", e.status, e.Attempts)
+	}
+}
@@ -0,0 +1,94 @@
+package portset
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Range struct {
+	From int
+	To   int
+}
+
+// Set is a list of port ranges parsed from masscan-like syntax: "22,80,8000-8100".
+type Set []Range
+
+func Parse(spec string) (Set, error) {
+	var set Set
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		lo, err := parsePort(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", part, err)
+		}
+
+		hi := lo
+		if isRange {
+			if hi, err = parsePort(to); err != nil {
+				return nil, fmt.Errorf("invalid port range %q: %w", part, err)
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("invalid port range %q: end before start", part)
+			}
+		}
+
+		set = append(set, Range{From: lo, To: hi})
+	}
+
+	return set, nil
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 65535 {
+		return 0, fmt.Errorf("port %d out of range 0-65535", p)
+	}
+	return p, nil
+}
+
+func (s Set) Contains(port int) bool {
+	for _, r := range s {
+		if port >= r.From && port <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Range) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+func (s Set) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Masscan returns the masscan -p argument for TCP and UDP ports:
+// "22,80,U:53,U:161-162".
+func Masscan(tcp, udp Set) string {
+	parts := make([]string, 0, len(tcp)+len(udp))
+	for _, r := range tcp {
+		parts = append(parts, r.String())
+	}
+	for _, r := range udp {
+		parts = append(parts, "U:"+r.String())
+	}
+	return strings.Join(parts, ",")
+}
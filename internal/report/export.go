@@ -0,0 +1,109 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+type exportEntry struct {
+	Change    string     `json:"change,omitempty"`
+	IP        string     `json:"ip"`
+	Hostname  string     `json:"hostname,omitempty"`
+	Port      int        `json:"port"`
+	Proto     string     `json:"proto"`
+	Banner    string     `json:"banner,omitempty"`
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+}
+
+func toEntry(change string, r model.ScanResult) exportEntry {
+	e := exportEntry{Change: change, IP: r.IP, Hostname: r.Hostname, Port: r.Port, Proto: r.Proto, Banner: r.Banner}
+	if !r.FirstSeen.IsZero() {
+		e.FirstSeen = &r.FirstSeen
+	}
+	if !r.LastSeen.IsZero() {
+		e.LastSeen = &r.LastSeen
+	}
+	return e
+}
+
+func diffEntries(d diff.DiffResult) []exportEntry {
+	entries := make([]exportEntry, 0, d.Total())
+	for _, r := range d.New {
+		entries = append(entries, toEntry("new", r))
+	}
+	for _, r := range d.Changed {
+		entries = append(entries, toEntry("changed", r))
+	}
+	for _, r := range d.Closed {
+		entries = append(entries, toEntry("closed", r))
+	}
+	return entries
+}
+
+func scanEntries(results []model.ScanResult) []exportEntry {
+	hosts, grouped := groupByHost(results)
+
+	entries := make([]exportEntry, 0, len(results))
+	for _, ip := range hosts {
+		for _, r := range grouped[ip] {
+			entries = append(entries, toEntry("", r))
+		}
+	}
+	return entries
+}
+
+func BuildDiffCSV(d diff.DiffResult) ([]byte, error) {
+	return writeCSV(diffEntries(d), true)
+}
+
+func BuildDiffJSON(d diff.DiffResult) ([]byte, error) {
+	return json.MarshalIndent(diffEntries(d), "", "  ")
+}
+
+func BuildScanCSV(results []model.ScanResult) ([]byte, error) {
+	return writeCSV(scanEntries(results), false)
+}
+
+func BuildScanJSON(results []model.ScanResult) ([]byte, error) {
+	return json.MarshalIndent(scanEntries(results), "", "  ")
+}
+
+func writeCSV(entries []exportEntry, withChange bool) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := []string{"ip", "port", "proto", "banner", "first_seen", "last_seen", "hostname"}
+	if withChange {
+		header = append([]string{"change"}, header...)
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		row := []string{e.IP, strconv.Itoa(e.Port), e.Proto, e.Banner, formatTime(e.FirstSeen), formatTime(e.LastSeen), e.Hostname}
+		if withChange {
+			row = append([]string{e.Change}, row...)
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -3,6 +3,8 @@ package report
 import (
 	"fmt"
 	"html"
+	"net/netip"
+	"slices"
 	"sort"
 	"strings"
 
@@ -17,39 +19,81 @@ func BuildScanReport(results []model.ScanResult) string {
 
 	var b strings.Builder
 
-	grouped := make(map[string][]model.ScanResult)
-	var hosts []string
-
-	for _, r := range results {
-		if _, exists := grouped[r.IP]; !exists {
-			hosts = append(hosts, r.IP)
-		}
-		grouped[r.IP] = append(grouped[r.IP], r)
-	}
-
-	sort.Strings(hosts)
+	hosts, grouped := groupByHost(results)
 
 	b.WriteString("\n SCAN REPORT \n")
 	b.WriteString(fmt.Sprintf("Hosts: %d | Open ports: %d\n", len(hosts), len(results)))
 
 	for _, ip := range hosts {
 		ports := grouped[ip]
-		sort.Slice(ports, func(i, j int) bool {
-			return ports[i].Port < ports[j].Port
-		})
 
 		var portList []string
 		for _, p := range ports {
 			portList = append(portList, fmt.Sprintf("%d/%s", p.Port, p.Proto))
 		}
 
-		b.WriteString(fmt.Sprintf("%-18s  %s\n", ip, strings.Join(portList, ", ")))
+		b.WriteString(fmt.Sprintf("%-18s  %s\n", hostLabel(ports), strings.Join(portList, ", ")))
 	}
 
 	b.WriteString("\n END\n")
 	return b.String()
 }
 
+// groupByHost returns hosts sorted by address and results per host sorted
+// by port. Hosts are normalized addresses, so IPv6 spellings group together.
+func groupByHost(results []model.ScanResult) ([]string, map[string][]model.ScanResult) {
+	grouped := make(map[string][]model.ScanResult)
+	var hosts []string
+
+	for _, r := range results {
+		ip := r.IP
+		if addr := r.Addr(); addr.IsValid() {
+			ip = addr.String()
+		}
+		if _, exists := grouped[ip]; !exists {
+			hosts = append(hosts, ip)
+		}
+		grouped[ip] = append(grouped[ip], r)
+	}
+
+	slices.SortFunc(hosts, compareIP)
+	for _, ip := range hosts {
+		ports := grouped[ip]
+		sort.Slice(ports, func(i, j int) bool {
+			return ports[i].Port < ports[j].Port
+		})
+	}
+
+	return hosts, grouped
+}
+
+// compareIP orders addresses numerically, IPv4 first, then anything that
+// is not an address as text.
+func compareIP(a, b string) int {
+	x, errA := netip.ParseAddr(a)
+	y, errB := netip.ParseAddr(b)
+	switch {
+	case errA == nil && errB == nil:
+		return x.Compare(y)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// hostLabel names a host by the results of one address, with a hostname if
+// any of them has one.
+func hostLabel(results []model.ScanResult) string {
+	for _, r := range results {
+		if r.Hostname != "" {
+			return r.Host()
+		}
+	}
+	return results[0].Host()
+}
+
 func BuildDiffReport(d diff.DiffResult) string {
 	if len(d.New) == 0 && len(d.Changed) == 0 && len(d.Closed) == 0 {
 		return "\nDIFF: No changes detected\n"
@@ -63,9 +107,9 @@ func BuildDiffReport(d diff.DiffResult) string {
 		b.WriteString(fmt.Sprintf("[NEW] (%d):\n", len(d.New)))
 		for _, r := range d.New {
 			if r.Banner != "" {
-				b.WriteString(fmt.Sprintf("   + %s:%d/%s  [%s]\n", r.IP, r.Port, r.Proto, r.Banner))
+				b.WriteString(fmt.Sprintf("   + %s/%s  [%s]\n", r.HostPort(), r.Proto, r.Banner))
 			} else {
-				b.WriteString(fmt.Sprintf("   + %s:%d/%s\n", r.IP, r.Port, r.Proto))
+				b.WriteString(fmt.Sprintf("   + %s/%s\n", r.HostPort(), r.Proto))
 			}
 		}
 		b.WriteString("\n")
@@ -74,7 +118,7 @@ func BuildDiffReport(d diff.DiffResult) string {
 	if len(d.Changed) > 0 {
 		b.WriteString(fmt.Sprintf("[CHANGED] (%d):\n", len(d.Changed)))
 		for _, r := range d.Changed {
-			b.WriteString(fmt.Sprintf("   ~ %s:%d/%s  [%s]\n", r.IP, r.Port, r.Proto, r.Banner))
+			b.WriteString(fmt.Sprintf("   ~ %s/%s  [%s]\n", r.HostPort(), r.Proto, r.Banner))
 		}
 		b.WriteString("\n")
 	}
@@ -82,7 +126,7 @@ func BuildDiffReport(d diff.DiffResult) string {
 	if len(d.Closed) > 0 {
 		b.WriteString(fmt.Sprintf("[CLOSED] (%d):\n", len(d.Closed)))
 		for _, r := range d.Closed {
-			b.WriteString(fmt.Sprintf("   - %s:%d/%s\n", r.IP, r.Port, r.Proto))
+			b.WriteString(fmt.Sprintf("   - %s/%s\n", r.HostPort(), r.Proto))
 		}
 		b.WriteString("\n")
 	}
@@ -103,8 +147,8 @@ func BuildDiffHTML(d diff.DiffResult) string {
 	if len(d.New) > 0 {
 		b.WriteString(fmt.Sprintf("<h3>New ports (%d)</h3><ul>", len(d.New)))
 		for _, r := range d.New {
-			b.WriteString(fmt.Sprintf("<li><b>%s:%d/%s</b> %s</li>",
-				html.EscapeString(r.IP), r.Port, r.Proto,
+			b.WriteString(fmt.Sprintf("<li><b>%s/%s</b> %s</li>",
+				html.EscapeString(r.HostPort()), r.Proto,
 				html.EscapeString(r.Banner)))
 		}
 		b.WriteString("</ul>")
@@ -113,8 +157,8 @@ func BuildDiffHTML(d diff.DiffResult) string {
 	if len(d.Changed) > 0 {
 		b.WriteString(fmt.Sprintf("<h3>Changed (%d)</h3><ul>", len(d.Changed)))
 		for _, r := range d.Changed {
-			b.WriteString(fmt.Sprintf("<li><b>%s:%d/%s</b> — %s</li>",
-				html.EscapeString(r.IP), r.Port, r.Proto,
+			b.WriteString(fmt.Sprintf("<li><b>%s/%s</b> — %s</li>",
+				html.EscapeString(r.HostPort()), r.Proto,
 				html.EscapeString(r.Banner)))
 		}
 		b.WriteString("</ul>")
@@ -123,11 +167,26 @@ func BuildDiffHTML(d diff.DiffResult) string {
 	if len(d.Closed) > 0 {
 		b.WriteString(fmt.Sprintf("<h3>Closed (%d)</h3><ul>", len(d.Closed)))
 		for _, r := range d.Closed {
-			b.WriteString(fmt.Sprintf("<li><b>%s:%d/%s</b></li>",
-				html.EscapeString(r.IP), r.Port, r.Proto))
+			b.WriteString(fmt.Sprintf("<li><b>%s/%s</b></li>",
+				html.EscapeString(r.HostPort()), r.Proto))
 		}
 		b.WriteString("</ul>")
 	}
 
 	return b.String()
 }
+
+// BuildDiffTop renders at most limit changes as text and HTML,
+// with a note about the omitted part. limit <= 0 renders everything.
+func BuildDiffTop(d diff.DiffResult, limit int) (string, string) {
+	if limit <= 0 || d.Total() <= limit {
+		return BuildDiffReport(d), BuildDiffHTML(d)
+	}
+
+	head := d.Head(limit)
+	note := fmt.Sprintf("Showing %d of %d changes (%d new, %d changed, %d closed), the full diff is attached.",
+		limit, d.Total(), len(d.New), len(d.Changed), len(d.Closed))
+
+	return BuildDiffReport(head) + "\n" + note + "\n",
+		BuildDiffHTML(head) + "<p><i>" + html.EscapeString(note) + "</i></p>"
+}
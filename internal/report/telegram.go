@@ -0,0 +1,115 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+// BuildDiffTelegram renders the diff for Telegram parse_mode=HTML.
+// Every value coming from the scan is escaped, banners go into <pre> blocks.
+func BuildDiffTelegram(d diff.DiffResult) string {
+	if len(d.New) == 0 && len(d.Changed) == 0 && len(d.Closed) == 0 {
+		return "<b>DIFF:</b> No changes detected"
+	}
+
+	var b strings.Builder
+
+	b.WriteString("<b>DIFF REPORT</b>\n")
+
+	writeTelegramSection(&b, "NEW", "+", d.New, true)
+	writeTelegramSection(&b, "CHANGED", "~", d.Changed, true)
+	writeTelegramSection(&b, "CLOSED", "-", d.Closed, false)
+
+	return b.String()
+}
+
+func writeTelegramSection(b *strings.Builder, title, sign string, results []model.ScanResult, banners bool) {
+	if len(results) == 0 {
+		return
+	}
+
+	b.WriteString(fmt.Sprintf("\n<b>[%s] (%d)</b>\n", title, len(results)))
+
+	hosts, grouped := groupByHost(results)
+	for _, ip := range hosts {
+		b.WriteString(fmt.Sprintf("<b>%s</b>\n", html.EscapeString(hostLabel(grouped[ip]))))
+		for _, r := range grouped[ip] {
+			b.WriteString(fmt.Sprintf("   %s %d/%s\n", sign, r.Port, html.EscapeString(r.Proto)))
+			if banners && r.Banner != "" {
+				b.WriteString(fmt.Sprintf("   <pre>%s</pre>\n", html.EscapeString(r.Banner)))
+			}
+		}
+	}
+}
+
+// BuildStatusTelegram renders the last run and the scheduling state of every
+// job for the /status command.
+func BuildStatusTelegram(runs []model.RunSummary, states map[string]model.JobState) string {
+	if len(runs) == 0 {
+		return "<b>STATUS:</b> no runs yet"
+	}
+
+	var b strings.Builder
+
+	b.WriteString("<b>STATUS</b>\n")
+	for _, run := range runs {
+		b.WriteString(fmt.Sprintf("\n<b>%s</b>\n", html.EscapeString(run.Job)))
+
+		state := states[run.Job]
+		if state.Running {
+			b.WriteString(fmt.Sprintf("Running since %s\n", state.LastStart.Format(time.DateTime)))
+		}
+		if !state.Next.IsZero() {
+			b.WriteString(fmt.Sprintf("Next run: %s\n", state.Next.Format(time.DateTime)))
+		}
+		if state.Overruns > 0 {
+			b.WriteString(fmt.Sprintf("Overruns: %d\n", state.Overruns))
+		}
+
+		if run.StartedAt.IsZero() {
+			b.WriteString("No runs yet\n")
+			continue
+		}
+
+		b.WriteString(fmt.Sprintf("Last run: %s (%s)\n",
+			run.StartedAt.Format(time.DateTime),
+			run.FinishedAt.Sub(run.StartedAt).Round(time.Second)))
+
+		if run.Err != "" {
+			b.WriteString(fmt.Sprintf("Result: <b>failed</b>\n<pre>%s</pre>\n", html.EscapeString(run.Err)))
+			continue
+		}
+		if run.Suspicious {
+			b.WriteString(fmt.Sprintf("Result: <b>suspicious drop</b> to %d open ports, diff skipped\n", run.Results))
+			continue
+		}
+
+		b.WriteString(fmt.Sprintf("Open ports: %d\n", run.Results))
+		b.WriteString(fmt.Sprintf("Diff: %d new, %d changed, %d closed\n", run.New, run.Changed, run.Closed))
+	}
+	return b.String()
+}
+
+// BuildHostTelegram renders the stored open ports of a host for the /host command.
+func BuildHostTelegram(ip string, results []model.ScanResult) string {
+	if len(results) == 0 {
+		return fmt.Sprintf("<b>%s</b>: no open ports known", html.EscapeString(ip))
+	}
+
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf("<b>%s</b> (%d open)\n", html.EscapeString(hostLabel(results)), len(results)))
+	for _, r := range results {
+		b.WriteString(fmt.Sprintf("   %d/%s  last seen %s\n",
+			r.Port, html.EscapeString(r.Proto), r.LastSeen.Format(time.DateTime)))
+		if r.Banner != "" {
+			b.WriteString(fmt.Sprintf("   <pre>%s</pre>\n", html.EscapeString(r.Banner)))
+		}
+	}
+	return b.String()
+}
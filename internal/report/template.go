@@ -0,0 +1,220 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+// TemplateData is the data model passed to user templates.
+//
+//	.Run        run metadata: .Project, .GeneratedAt, .OpenPorts
+//	.Counts     .New, .Changed, .Closed, .Total
+//	.Entries    every change: .Change, .Severity, .IP, .Hostname, .Host, .Port, .Proto, .Banner, .FirstSeen, .LastSeen
+//	.New, .Changed, .Closed   entries split by change type
+//	.Hosts      entries grouped by host, sorted: .IP, .Host, .Entries
+type TemplateData struct {
+	Run     RunInfo
+	Counts  Counts
+	Entries []Entry
+	New     []Entry
+	Changed []Entry
+	Closed  []Entry
+	Hosts   []HostGroup
+}
+
+type RunInfo struct {
+	Project     string
+	GeneratedAt time.Time
+	OpenPorts   int
+}
+
+type Counts struct {
+	New     int
+	Changed int
+	Closed  int
+	Total   int
+}
+
+type Entry struct {
+	Change    string
+	Severity  string
+	IP        string
+	Hostname  string
+	Host      string
+	Port      int
+	Proto     string
+	Banner    string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+type HostGroup struct {
+	IP      string
+	Host    string
+	Entries []Entry
+}
+
+func NewTemplateData(project string, d diff.DiffResult, results []model.ScanResult, classifier diff.Classifier) TemplateData {
+	data := TemplateData{
+		Run: RunInfo{
+			Project:     project,
+			GeneratedAt: time.Now(),
+			OpenPorts:   len(results),
+		},
+		Counts: Counts{
+			New:     len(d.New),
+			Changed: len(d.Changed),
+			Closed:  len(d.Closed),
+			Total:   d.Total(),
+		},
+	}
+
+	var all []model.ScanResult
+	changes := make(map[string]diff.Change)
+
+	d.Each(func(change diff.Change, r model.ScanResult) {
+		e := newEntry(change, r, classifier)
+		data.Entries = append(data.Entries, e)
+
+		switch change {
+		case diff.ChangeNew:
+			data.New = append(data.New, e)
+		case diff.ChangeChanged:
+			data.Changed = append(data.Changed, e)
+		case diff.ChangeClosed:
+			data.Closed = append(data.Closed, e)
+		}
+
+		all = append(all, r)
+		changes[r.Key()] = change
+	})
+
+	hosts, grouped := groupByHost(all)
+	for _, ip := range hosts {
+		g := HostGroup{IP: ip, Host: hostLabel(grouped[ip])}
+		for _, r := range grouped[ip] {
+			g.Entries = append(g.Entries, newEntry(changes[r.Key()], r, classifier))
+		}
+		data.Hosts = append(data.Hosts, g)
+	}
+
+	return data
+}
+
+func newEntry(change diff.Change, r model.ScanResult, classifier diff.Classifier) Entry {
+	return Entry{
+		Change:    string(change),
+		Severity:  classifier.Severity(change, r).String(),
+		IP:        r.IP,
+		Hostname:  r.Hostname,
+		Host:      r.Host(),
+		Port:      r.Port,
+		Proto:     r.Proto,
+		Banner:    r.Banner,
+		FirstSeen: r.FirstSeen,
+		LastSeen:  r.LastSeen,
+	}
+}
+
+var templateFuncs = map[string]any{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// Templates holds user templates of a notifier. Nil fields mean
+// the built-in renderer is used.
+type Templates struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// LoadTemplates parses the subject template string and the text/html
+// template files; empty arguments are skipped.
+func LoadTemplates(subject, textPath, htmlPath string) (*Templates, error) {
+	t := &Templates{}
+
+	if subject != "" {
+		tmpl, err := texttemplate.New("subject").Funcs(templateFuncs).Parse(subject)
+		if err != nil {
+			return nil, fmt.Errorf("subject template: %w", err)
+		}
+		t.subject = tmpl
+	}
+
+	if textPath != "" {
+		src, err := os.ReadFile(textPath)
+		if err != nil {
+			return nil, fmt.Errorf("text template: %w", err)
+		}
+		tmpl, err := texttemplate.New(filepath.Base(textPath)).Funcs(templateFuncs).Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("text template: %w", err)
+		}
+		t.text = tmpl
+	}
+
+	if htmlPath != "" {
+		src, err := os.ReadFile(htmlPath)
+		if err != nil {
+			return nil, fmt.Errorf("html template: %w", err)
+		}
+		tmpl, err := htmltemplate.New(filepath.Base(htmlPath)).Funcs(templateFuncs).Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("html template: %w", err)
+		}
+		t.html = tmpl
+	}
+
+	return t, nil
+}
+
+// Subject renders the subject template or returns fallback.
+func (t *Templates) Subject(data TemplateData, fallback string) (string, error) {
+	if t == nil || t.subject == nil {
+		return fallback, nil
+	}
+	var buf bytes.Buffer
+	if err := t.subject.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("subject template: %w", err)
+	}
+	// headers must be a single line
+	return strings.Join(strings.Fields(buf.String()), " "), nil
+}
+
+// Text renders the text template or returns fallback.
+func (t *Templates) Text(data TemplateData, fallback string) (string, error) {
+	if t == nil || t.text == nil {
+		return fallback, nil
+	}
+	var buf bytes.Buffer
+	if err := t.text.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("text template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// HTML renders the html template or returns fallback.
+func (t *Templates) HTML(data TemplateData, fallback string) (string, error) {
+	if t == nil || t.html == nil {
+		return fallback, nil
+	}
+	var buf bytes.Buffer
+	if err := t.html.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("html template: %w", err)
+	}
+	return buf.String(), nil
+}
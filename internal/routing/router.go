@@ -0,0 +1,169 @@
+package routing
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
+	"github.com/Qwental/port-scanner-alert-system/internal/target"
+)
+
+type rule struct {
+	name        string
+	prefixes    []netip.Prefix
+	ports       portset.Set
+	changes     map[diff.Change]bool
+	minSeverity diff.Severity
+	notify      []string
+}
+
+// Router splits a diff into per-notifier subsets according to routing rules.
+type Router struct {
+	rules      []rule
+	defaults   []string
+	classifier diff.Classifier
+}
+
+// New builds a router. known lists the configured notifier names, defaults
+// are used when cfg.Default is empty.
+func New(cfg config.RoutingConfig, groups map[string][]string, classifier diff.Classifier, known, defaults []string) (*Router, error) {
+	names := make(map[string]bool, len(known))
+	for _, n := range known {
+		names[n] = true
+	}
+
+	checkNotify := func(where string, list []string) error {
+		for _, n := range list {
+			if !names[n] {
+				return fmt.Errorf("%s: unknown notifier %q", where, n)
+			}
+		}
+		return nil
+	}
+
+	r := &Router{defaults: defaults, classifier: classifier}
+	if len(cfg.Default) > 0 {
+		if err := checkNotify("routing.default", cfg.Default); err != nil {
+			return nil, err
+		}
+		r.defaults = cfg.Default
+	}
+
+	for i, rc := range cfg.Rules {
+		where := fmt.Sprintf("routing rule %d", i+1)
+		if rc.Name != "" {
+			where = fmt.Sprintf("routing rule %q", rc.Name)
+		}
+
+		if len(rc.Notify) == 0 {
+			return nil, fmt.Errorf("%s: notify is empty", where)
+		}
+		if err := checkNotify(where, rc.Notify); err != nil {
+			return nil, err
+		}
+
+		ru := rule{name: rc.Name, notify: rc.Notify}
+
+		for _, c := range rc.CIDRs {
+			prefixes, err := target.Parse(c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			ru.prefixes = append(ru.prefixes, prefixes...)
+		}
+
+		for _, g := range rc.Groups {
+			members, ok := groups[g]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown target group %q", where, g)
+			}
+			for _, m := range members {
+				prefixes, err := target.Parse(m)
+				if err != nil {
+					return nil, fmt.Errorf("target group %q: %w", g, err)
+				}
+				ru.prefixes = append(ru.prefixes, prefixes...)
+			}
+		}
+
+		if rc.Ports != "" {
+			ports, err := portset.Parse(rc.Ports)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			ru.ports = ports
+		}
+
+		if len(rc.Changes) > 0 {
+			ru.changes = make(map[diff.Change]bool)
+			for _, c := range rc.Changes {
+				change, err := diff.ParseChange(c)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", where, err)
+				}
+				ru.changes[change] = true
+			}
+		}
+
+		if rc.MinSeverity != "" {
+			sev, err := diff.ParseSeverity(rc.MinSeverity)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			ru.minSeverity = sev
+		}
+
+		r.rules = append(r.rules, ru)
+	}
+
+	return r, nil
+}
+
+// Route returns the part of the diff each notifier should receive.
+func (r *Router) Route(d diff.DiffResult) map[string]diff.DiffResult {
+	out := make(map[string]diff.DiffResult)
+
+	d.Each(func(change diff.Change, res model.ScanResult) {
+		targets := make(map[string]bool)
+		for _, ru := range r.rules {
+			if r.matches(ru, change, res) {
+				for _, n := range ru.notify {
+					targets[n] = true
+				}
+			}
+		}
+
+		if len(targets) == 0 {
+			for _, n := range r.defaults {
+				targets[n] = true
+			}
+		}
+
+		for n := range targets {
+			sub := out[n]
+			sub.Add(change, res)
+			out[n] = sub
+		}
+	})
+
+	return out
+}
+
+func (r *Router) matches(ru rule, change diff.Change, res model.ScanResult) bool {
+	if len(ru.prefixes) > 0 {
+		addr, err := netip.ParseAddr(res.IP)
+		if err != nil || !target.ContainsAddr(ru.prefixes, addr) {
+			return false
+		}
+	}
+	if len(ru.ports) > 0 && !ru.ports.Contains(res.Port) {
+		return false
+	}
+	if ru.changes != nil && !ru.changes[change] {
+		return false
+	}
+	return r.classifier.Severity(change, res) >= ru.minSeverity
+}
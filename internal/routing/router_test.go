@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+	"github.com/Qwental/port-scanner-alert-system/internal/diff"
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
+)
+
+var known = []string{"telegram", "email", "soc", "lab-mail"}
+
+func routedKeys(d diff.DiffResult) []string {
+	var keys []string
+	d.Each(func(change diff.Change, r model.ScanResult) {
+		keys = append(keys, string(change)+" "+r.Key())
+	})
+	slices.Sort(keys)
+	return keys
+}
+
+func TestRoute(t *testing.T) {
+	critical, err := portset.Parse("3389")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := map[string][]string{
+		"dmz": {"10.10.0.0/24"},
+		"lab": {"192.168.66.1-192.168.66.20", "2001:db8::1-2001:db8::ff"},
+	}
+	cfg := config.RoutingConfig{
+		Default: []string{"telegram"},
+		Rules: []config.RouteRule{
+			{Name: "dmz", Groups: []string{"dmz"}, Notify: []string{"soc", "email"}},
+			{Name: "lab", Groups: []string{"lab"}, Notify: []string{"lab-mail"}},
+			{Name: "office", CIDRs: []string{"172.16.0.10-172.16.0.12"}, Ports: "80", Notify: []string{"email"}},
+			{Name: "critical", MinSeverity: "critical", Changes: []string{"new"}, Notify: []string{"soc"}},
+		},
+	}
+	r, err := New(cfg, groups, diff.Classifier{Critical: critical}, known, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := diff.DiffResult{
+		New: []model.ScanResult{
+			{IP: "10.10.0.5", Port: 22, Proto: "tcp"},
+			{IP: "192.168.66.20", Port: 80, Proto: "tcp"},
+			{IP: "192.168.66.21", Port: 80, Proto: "tcp"},
+			{IP: "2001:db8::80", Port: 443, Proto: "tcp"},
+			{IP: "172.16.0.11", Port: 80, Proto: "tcp"},
+			{IP: "172.16.0.11", Port: 3389, Proto: "tcp"},
+		},
+		Closed: []model.ScanResult{
+			{IP: "172.16.0.13", Port: 80, Proto: "tcp"},
+			{IP: "172.16.0.12", Port: 3389, Proto: "tcp"},
+		},
+	}
+	got := r.Route(d)
+
+	want := map[string][]string{
+		"soc":      {"new 10.10.0.5:22/tcp", "new 172.16.0.11:3389/tcp"},
+		"email":    {"new 10.10.0.5:22/tcp", "new 172.16.0.11:80/tcp"},
+		"lab-mail": {"new 192.168.66.20:80/tcp", "new [2001:db8::80]:443/tcp"},
+		"telegram": {"closed 172.16.0.12:3389/tcp", "closed 172.16.0.13:80/tcp", "new 192.168.66.21:80/tcp"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("routed to %d notifiers, want %d", len(got), len(want))
+	}
+	for n, w := range want {
+		if keys := routedKeys(got[n]); !slices.Equal(keys, w) {
+			t.Errorf("%s got %v, want %v", n, keys, w)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	groups := map[string][]string{"bad": {"10.0.0.9-10.0.0.1"}}
+	tests := []struct {
+		rule config.RouteRule
+		err  string
+	}{
+		{config.RouteRule{Notify: []string{"pager"}}, `unknown notifier "pager"`},
+		{config.RouteRule{Name: "x"}, "notify is empty"},
+		{config.RouteRule{CIDRs: []string{"10.0.0.0/33"}, Notify: known[:1]}, "invalid CIDR"},
+		{config.RouteRule{CIDRs: []string{"10.0.0.5-10.0.0.1"}, Notify: known[:1]}, "invalid range"},
+		{config.RouteRule{Groups: []string{"missing"}, Notify: known[:1]}, `unknown target group "missing"`},
+		{config.RouteRule{Groups: []string{"bad"}, Notify: known[:1]}, `target group "bad"`},
+		{config.RouteRule{Ports: "99999", Notify: known[:1]}, "rule 1"},
+		{config.RouteRule{Changes: []string{"moved"}, Notify: known[:1]}, "rule 1"},
+		{config.RouteRule{MinSeverity: "urgent", Notify: known[:1]}, "rule 1"},
+	}
+	for _, tt := range tests {
+		cfg := config.RoutingConfig{Rules: []config.RouteRule{tt.rule}}
+		_, err := New(cfg, groups, diff.Classifier{}, known, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("New(%+v) error = %v, want %q", tt.rule, err, tt.err)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package scanner
 
 import (
 	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/netip"
 	"os"
 	"os/exec"
 	"strings"
@@ -11,26 +14,64 @@ import (
 
 	"github.com/Qwental/port-scanner-alert-system/internal/config"
 	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
 	"go.uber.org/zap"
 )
 
+// udpPayloads are the protocol probes masscan sends to UDP ports.
+//
+//go:embed nmap-payloads
+var udpPayloads string
+
 type MasscanWrapper struct {
 	cfg config.MasscanConfig
-	log *zap.SugaredLogger
+	// ports is the -p argument, UDP ports with masscan's "U:" prefix
+	ports string
+	udp   bool
+	log   *zap.SugaredLogger
 }
 
+// NewMasscanWrapper expects validated port lists.
 func NewMasscanWrapper(cfg config.MasscanConfig, log *zap.SugaredLogger) *MasscanWrapper {
-	return &MasscanWrapper{cfg: cfg, log: log}
+	tcp, _ := portset.Parse(string(cfg.Ports))
+	udp, _ := portset.Parse(string(cfg.UDPPorts))
+	return &MasscanWrapper{cfg: cfg, ports: portset.Masscan(tcp, udp), udp: len(udp) > 0, log: log}
+}
+
+// Ports returns the scanned ports as passed to masscan: "22,80,U:53".
+func (m *MasscanWrapper) Ports() string {
+	return m.ports
 }
 
-func (m *MasscanWrapper) Run(ctx context.Context, targets []string) ([]model.ScanResult, error) {
+// Run scans targets in parallel. Addresses in exclude are passed to masscan
+// with --excludefile and never probed. UDP ports get the probes of
+// nmap-payloads.
+func (m *MasscanWrapper) Run(ctx context.Context, targets, exclude []string) ([]model.ScanResult, error) {
 	if len(targets) == 0 {
 		return nil, fmt.Errorf("no targets specified")
 	}
 
+	var files scanFiles
+	if len(exclude) > 0 {
+		path, err := writeTempFile("masscan-exclude-*.txt", strings.Join(exclude, "\n")+"\n")
+		if err != nil {
+			return nil, fmt.Errorf("exclude file: %w", err)
+		}
+		defer os.Remove(path)
+		files.exclude = path
+	}
+	if m.udp {
+		path, err := writeTempFile("masscan-payloads-*.txt", udpPayloads)
+		if err != nil {
+			return nil, fmt.Errorf("payloads file: %w", err)
+		}
+		defer os.Remove(path)
+		files.payloads = path
+	}
+
 	// single target — no need for goroutines
 	if len(targets) == 1 {
-		return m.scanTarget(ctx, targets[0])
+		return m.scanTarget(ctx, targets[0], files)
 	}
 
 	var (
@@ -46,7 +87,7 @@ func (m *MasscanWrapper) Run(ctx context.Context, targets []string) ([]model.Sca
 			defer wg.Done()
 
 			m.log.Infof("Starting scan for target: %s", t)
-			results, err := m.scanTarget(ctx, t)
+			results, err := m.scanTarget(ctx, t, files)
 
 			mu.Lock()
 			defer mu.Unlock()
@@ -65,25 +106,46 @@ func (m *MasscanWrapper) Run(ctx context.Context, targets []string) ([]model.Sca
 		for _, e := range errs {
 			m.log.Errorf("Scan error: %v", e)
 		}
+		// partial results would show the failed targets as closed
+		return allResults, errors.Join(errs...)
 	}
 
 	m.log.Infof("Scan complete: %d results from %d targets", len(allResults), len(targets))
 	return allResults, nil
 }
 
-func (m *MasscanWrapper) scanTarget(ctx context.Context, target string) ([]model.ScanResult, error) {
+// scanFiles are the temporary files shared by the masscan runs of a scan.
+type scanFiles struct {
+	exclude  string
+	payloads string
+}
+
+// args returns the masscan arguments for a target.
+func (m *MasscanWrapper) args(target string, files scanFiles) []string {
 	args := []string{
 		"-oJ", "-",
 		"--banners",
 		"--rate", m.cfg.Rate,
-		"-p", m.cfg.Ports,
+		"-p", m.ports,
 	}
 
 	if m.cfg.Interface != "" {
 		args = append(args, "-e", m.cfg.Interface)
 	}
 
-	args = append(args, target)
+	if files.exclude != "" {
+		args = append(args, "--excludefile", files.exclude)
+	}
+
+	if files.payloads != "" {
+		args = append(args, "--nmap-payloads", files.payloads)
+	}
+
+	return append(args, target)
+}
+
+func (m *MasscanWrapper) scanTarget(ctx context.Context, target string, files scanFiles) ([]model.ScanResult, error) {
+	args := m.args(target, files)
 
 	m.log.Infof("Masscan args: %s", strings.Join(args, " "))
 
@@ -103,8 +165,10 @@ func (m *MasscanWrapper) scanTarget(ctx context.Context, target string) ([]model
 	decoder := json.NewDecoder(stdout)
 
 	if _, err := decoder.Token(); err != nil {
+		if err := m.wait(ctx, cmd); err != nil {
+			return nil, err
+		}
 		m.log.Warnf("No scan output for %s: %v", target, err)
-		_ = cmd.Wait()
 		return results, nil
 	}
 
@@ -121,10 +185,16 @@ func (m *MasscanWrapper) scanTarget(ctx context.Context, target string) ([]model
 			continue
 		}
 
+		// one spelling per address, so IPv6 results match stored ones
+		ip := raw.IP
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			ip = addr.Unmap().String()
+		}
+
 		for _, p := range raw.Ports {
 			if p.Status == "open" {
 				results = append(results, model.ScanResult{
-					IP:     raw.IP,
+					IP:     ip,
 					Port:   p.Port,
 					Proto:  p.Proto,
 					Banner: p.Service.Banner,
@@ -133,6 +203,34 @@ func (m *MasscanWrapper) scanTarget(ctx context.Context, target string) ([]model
 		}
 	}
 
-	_ = cmd.Wait()
+	if err := m.wait(ctx, cmd); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
+
+// wait reports a non-zero masscan exit unless the scan was cancelled.
+func (m *MasscanWrapper) wait(ctx context.Context, cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if err == nil || ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("masscan failed: %w", err)
+}
+
+// writeTempFile writes data to a new temporary file and returns its path.
+func writeTempFile(pattern, data string) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
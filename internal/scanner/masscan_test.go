@@ -0,0 +1,225 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+)
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.MasscanConfig
+		files scanFiles
+		want  []string
+	}{
+		{
+			name: "tcp only",
+			cfg:  config.MasscanConfig{Rate: "1000", Ports: "22,80"},
+			want: []string{"-oJ", "-", "--banners", "--rate", "1000", "-p", "22,80", "10.0.0.0/24"},
+		},
+		{
+			name:  "udp with probes",
+			cfg:   config.MasscanConfig{Rate: "500", Interface: "eth0", Ports: "22", UDPPorts: "53,1900"},
+			files: scanFiles{exclude: "/tmp/exclude.txt", payloads: "/tmp/payloads.txt"},
+			want: []string{
+				"-oJ", "-", "--banners", "--rate", "500", "-p", "22,U:53,U:1900",
+				"-e", "eth0", "--excludefile", "/tmp/exclude.txt",
+				"--nmap-payloads", "/tmp/payloads.txt", "10.0.0.0/24",
+			},
+		},
+	}
+	for _, tt := range tests {
+		m := NewMasscanWrapper(tt.cfg, zap.NewNop().Sugar())
+		if got := m.args("10.0.0.0/24", tt.files); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: args = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeMasscan puts a masscan on PATH that records its arguments and the
+// payloads file it was given into dir and reports no open ports.
+func fakeMasscan(t *testing.T) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	script := `#!/bin/sh
+printf '%s\n' "$@" > "` + dir + `/args"
+while [ $# -gt 0 ]; do
+	if [ "$1" = --nmap-payloads ]; then cp "$2" "` + dir + `/payloads"; fi
+	shift
+done
+echo '[]'
+`
+	if err := os.WriteFile(filepath.Join(dir, "masscan"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestRunPassesPayloads(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.MasscanConfig
+		payloads bool
+	}{
+		{"tcp only", config.MasscanConfig{Rate: "100", Ports: "22"}, false},
+		{"udp only", config.MasscanConfig{Rate: "100", UDPPorts: "53,5353"}, true},
+		{"tcp and udp", config.MasscanConfig{Rate: "100", Ports: "22", UDPPorts: "1900"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := fakeMasscan(t)
+			m := NewMasscanWrapper(tt.cfg, zap.NewNop().Sugar())
+
+			if _, err := m.Run(context.Background(), []string{"10.0.0.1"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "args"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := strings.Split(strings.TrimSpace(string(data)), "\n")
+			i := slices.Index(args, "--nmap-payloads")
+			if (i >= 0) != tt.payloads {
+				t.Fatalf("args = %q, want --nmap-payloads: %v", args, tt.payloads)
+			}
+			if !tt.payloads {
+				return
+			}
+
+			sent, err := os.ReadFile(filepath.Join(dir, "payloads"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(sent) != udpPayloads {
+				t.Error("payloads file differs from nmap-payloads")
+			}
+			if _, err := os.Stat(args[i+1]); !os.IsNotExist(err) {
+				t.Errorf("payloads file %s left behind: %v", args[i+1], err)
+			}
+		})
+	}
+}
+
+// parsePayloads decodes the udp lines of an nmap-payloads file.
+func parsePayloads(t *testing.T, data string) map[int][]byte {
+	t.Helper()
+	out := make(map[int][]byte)
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[0] != "udp" {
+			t.Fatalf("line %d: %q is not a udp payload", n+1, line)
+		}
+		quoted := fields[2]
+		if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+			t.Fatalf("line %d: payload is not a single quoted string", n+1)
+		}
+
+		var b bytes.Buffer
+		s := quoted[1 : len(quoted)-1]
+		for i := 0; i < len(s); i++ {
+			if s[i] == '"' {
+				t.Fatalf("line %d: unescaped quote", n+1)
+			}
+			if s[i] != '\\' {
+				b.WriteByte(s[i])
+				continue
+			}
+			i++
+			switch s[i] {
+			case 'r':
+				b.WriteByte('\r')
+			case 'n':
+				b.WriteByte('\n')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'x':
+				v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+				if err != nil {
+					t.Fatalf("line %d: bad escape %q", n+1, s[i-1:i+3])
+				}
+				b.WriteByte(byte(v))
+				i += 2
+			default:
+				t.Fatalf("line %d: unknown escape \\%c", n+1, s[i])
+			}
+		}
+
+		for _, p := range strings.Split(fields[1], ",") {
+			port, err := strconv.Atoi(p)
+			if err != nil {
+				t.Fatalf("line %d: bad port %q", n+1, p)
+			}
+			out[port] = b.Bytes()
+		}
+	}
+	return out
+}
+
+// dnsQuestion returns the name, type and class of the single question of a
+// DNS query.
+func dnsQuestion(t *testing.T, msg []byte) (string, int, int) {
+	t.Helper()
+	if len(msg) < 12 || msg[4] != 0 || msg[5] != 1 {
+		t.Fatalf("not a DNS query with one question: %x", msg)
+	}
+	var labels []string
+	i := 12
+	for msg[i] != 0 {
+		n := int(msg[i])
+		labels = append(labels, string(msg[i+1:i+1+n]))
+		i += 1 + n
+	}
+	rest := msg[i+1:]
+	if len(rest) != 4 {
+		t.Fatalf("%d bytes after the question name, want 4", len(rest))
+	}
+	return strings.Join(labels, "."), int(rest[0])<<8 | int(rest[1]), int(rest[2])<<8 | int(rest[3])
+}
+
+func TestPayloads(t *testing.T) {
+	payloads := parsePayloads(t, udpPayloads)
+
+	for _, port := range []int{53, 123, 161, 1900, 5353} {
+		if len(payloads[port]) == 0 {
+			t.Errorf("no probe for udp %d", port)
+		}
+	}
+
+	if name, qtype, class := dnsQuestion(t, payloads[53]); name != "version.bind" || qtype != 16 || class != 3 {
+		t.Errorf("DNS probe asks %s type %d class %d", name, qtype, class)
+	}
+	if name, qtype, class := dnsQuestion(t, payloads[5353]); name != "_services._dns-sd._udp.local" || qtype != 12 || class != 1 {
+		t.Errorf("mDNS probe asks %s type %d class %d", name, qtype, class)
+	}
+
+	if ntp := payloads[123]; len(ntp) != 48 || ntp[0]&0x07 != 3 || ntp[0]>>3&0x07 != 4 {
+		t.Errorf("NTP probe is not a 48-byte v4 client request: %x", ntp)
+	}
+
+	snmp := payloads[161]
+	if len(snmp) < 2 || snmp[0] != 0x30 || int(snmp[1]) != len(snmp)-2 || !bytes.Contains(snmp, []byte("\x04\x06public")) {
+		t.Errorf("SNMP probe is not a BER message with community public: %x", snmp)
+	}
+
+	ssdp := string(payloads[1900])
+	if !strings.HasPrefix(ssdp, "M-SEARCH * HTTP/1.1\r\n") || !strings.Contains(ssdp, "MAN: \"ssdp:discover\"\r\n") ||
+		!strings.HasSuffix(ssdp, "\r\n\r\n") {
+		t.Errorf("SSDP probe is not an M-SEARCH: %q", ssdp)
+	}
+}
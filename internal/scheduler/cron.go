@@ -0,0 +1,305 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/config"
+)
+
+// Schedule returns the next activation time strictly after t.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every is a fixed interval schedule.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return "every " + time.Duration(e).String()
+}
+
+// Cron is a standard 5-field cron schedule: minute hour day-of-month month day-of-week.
+type Cron struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// day-of-month and day-of-week are OR-ed when both are restricted
+	domAny bool
+	dowAny bool
+	loc    *time.Location
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// ParseCron parses a cron expression evaluated in loc (time.Local if nil).
+// Supports *, lists, ranges, steps, month/day names and @hourly-style macros.
+func ParseCron(expr string, loc *time.Location) (*Cron, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	c := &Cron{expr: expr, loc: loc}
+
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron %q minute: %w", expr, err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron %q hour: %w", expr, err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron %q day of month: %w", expr, err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("cron %q month: %w", expr, err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("cron %q day of week: %w", expr, err)
+	}
+	// 7 is an alias for Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	c.domAny = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	c.dowAny = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron %q never matches", expr)
+	}
+
+	return c, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(from, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(to, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowOK
+	case c.dowAny:
+		return domOK
+	}
+	return domOK || dowOK
+}
+
+// Next returns the next activation after t. Times in an hour skipped by a
+// DST gap activate once, when the gap ends; times in an hour repeated when
+// clocks go back activate once, unless the expression matches every hour.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	// a valid expression matches at least once in 5 years (Feb 29 on a given weekday)
+	limit := t.AddDate(5, 0, 0)
+
+	// gap is the hour t should have started at if a DST gap moved it, or -1
+	gap := -1
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t, gap = c.forward(t, t.Year(), t.Month()+1, 1, 0)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t, gap = c.forward(t, t.Year(), t.Month(), t.Day()+1, 0)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			if gap >= 0 && c.hour&hourRange(gap, t.Hour()) != 0 {
+				return t
+			}
+			t, gap = c.forward(t, t.Year(), t.Month(), t.Day(), t.Hour()+1)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t, gap = t.Add(time.Minute), -1
+			continue
+		}
+		if _, ok := firstOccurrence(t); ok && c.hour != allHours {
+			t, gap = t.Add(time.Minute), -1
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// forward moves t to the start of the given hour. If a DST gap moved that
+// hour later on the same day, gap is the skipped hour, else -1.
+func (c *Cron) forward(t time.Time, year int, month time.Month, day, hour int) (next time.Time, gap int) {
+	next = time.Date(year, month, day, hour, 0, 0, 0, c.loc)
+	if first, ok := firstOccurrence(next); ok && first.After(t) {
+		next = first
+	}
+	if !next.After(t) {
+		// a DST change normalized next to a time that is not after t
+		return t.Add(time.Hour), -1
+	}
+
+	want := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	wall := time.Date(next.Year(), next.Month(), next.Day(), next.Hour(), next.Minute(), 0, 0, time.UTC)
+	if !wall.Equal(want) && wall.Day() == want.Day() {
+		return next, want.Hour()
+	}
+	return next, -1
+}
+
+// firstOccurrence returns the earlier time with the same wall clock if t
+// is in the hour repeated when clocks go back.
+func firstOccurrence(t time.Time) (time.Time, bool) {
+	for _, d := range []time.Duration{30 * time.Minute, time.Hour} {
+		if e := t.Add(-d); e.Hour() == t.Hour() && e.Minute() == t.Minute() {
+			return e, true
+		}
+	}
+	return t, false
+}
+
+const allHours = 1<<24 - 1
+
+// hourRange returns the bits of the hours from up to, but not including, to.
+func hourRange(from, to int) uint64 {
+	var bits uint64
+	for h := from; h < to; h++ {
+		bits |= 1 << uint(h)
+	}
+	return bits
+}
+
+func (c *Cron) String() string {
+	return fmt.Sprintf("cron %q (%s)", c.expr, c.loc)
+}
+
+// FromConfig builds the schedule of a scheduler config section.
+func FromConfig(cfg config.SchedulerConfig) (Schedule, error) {
+	if cfg.Cron == "" {
+		interval, err := time.ParseDuration(cfg.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", cfg.Interval, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %q: must be positive", cfg.Interval)
+		}
+		return Every(interval), nil
+	}
+
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+		}
+	}
+	return ParseCron(cfg.Cron, loc)
+}
+
+// OptionsFromConfig parses the run policy part of the scheduler config.
+func OptionsFromConfig(cfg config.SchedulerConfig) (Options, error) {
+	overlap, err := ParseOverlap(cfg.Overlap)
+	if err != nil {
+		return Options{}, err
+	}
+
+	opts := Options{RunOnStart: !cfg.SkipFirstRun, Overlap: overlap}
+	if cfg.Jitter != "" {
+		if opts.Jitter, err = time.ParseDuration(cfg.Jitter); err != nil {
+			return Options{}, fmt.Errorf("invalid jitter %q: %w", cfg.Jitter, err)
+		}
+		if opts.Jitter < 0 {
+			return Options{}, fmt.Errorf("invalid jitter %q: must not be negative", cfg.Jitter)
+		}
+	}
+	return opts, nil
+}
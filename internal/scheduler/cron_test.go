@@ -0,0 +1,270 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustLoc(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"* * * *", "expected 5 fields"},
+		{"60 * * * *", "minute"},
+		{"* 24 * * *", "hour"},
+		{"* * 0 * *", "day of month"},
+		{"* * * 13 *", "month"},
+		{"* * * * 8", "day of week"},
+		{"5-2 * * * *", "out of range"},
+		{"*/0 * * * *", "invalid step"},
+		{"*/x * * * *", "invalid step"},
+		{"a * * * *", "invalid value"},
+		{"* * * foo *", "invalid value"},
+		{"0 0 30 2 *", "never matches"},
+		{"0 0 31 4,6,9,11 *", "never matches"},
+	}
+	for _, tt := range tests {
+		_, err := ParseCron(tt.expr, time.UTC)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseCron(%q) = %v, want error containing %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestCronFields(t *testing.T) {
+	tests := []struct {
+		expr   string
+		minute uint64
+		hour   uint64
+		dow    uint64
+	}{
+		{"0 0 * * *", 1, 1, 0x7f},
+		{"*/15 * * * *", 1<<0 | 1<<15 | 1<<30 | 1<<45, 1<<24 - 1, 0x7f},
+		{"1-10/3 * * * *", 1<<1 | 1<<4 | 1<<7 | 1<<10, 1<<24 - 1, 0x7f},
+		{"5/20 * * * *", 1<<5 | 1<<25 | 1<<45, 1<<24 - 1, 0x7f},
+		{"0,30 9-17 * * *", 1 | 1<<30, 0x3fe00, 0x7f},
+		{"0 0 * * mon-fri", 1, 1, 0x3e},
+		{"0 0 * * SAT,7", 1, 1, 1<<6 | 1 | 1<<7},
+		{"@hourly", 1, 1<<24 - 1, 0x7f},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr, time.UTC)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if c.minute != tt.minute || c.hour != tt.hour || c.dow&0x7f != tt.dow&0x7f {
+			t.Errorf("ParseCron(%q) = minute %b hour %b dow %b, want %b %b %b",
+				tt.expr, c.minute, c.hour, c.dow, tt.minute, tt.hour, tt.dow)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin := mustLoc(t, "Europe/Berlin")
+	newYork := mustLoc(t, "America/New_York")
+
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "strictly after a matching time",
+			expr: "30 2 * * *",
+			loc:  time.UTC,
+			from: time.Date(2025, 5, 1, 2, 30, 0, 0, time.UTC),
+			want: []time.Time{time.Date(2025, 5, 2, 2, 30, 0, 0, time.UTC)},
+		},
+		{
+			name: "seconds are truncated",
+			expr: "* * * * *",
+			loc:  time.UTC,
+			from: time.Date(2025, 5, 1, 2, 30, 59, 999, time.UTC),
+			want: []time.Time{time.Date(2025, 5, 1, 2, 31, 0, 0, time.UTC)},
+		},
+		{
+			name: "steps across the hour",
+			expr: "*/20 * * * *",
+			loc:  time.UTC,
+			from: time.Date(2025, 5, 1, 10, 41, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2025, 5, 1, 11, 0, 0, 0, time.UTC),
+				time.Date(2025, 5, 1, 11, 20, 0, 0, time.UTC),
+				time.Date(2025, 5, 1, 11, 40, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "ranges skip to the next day",
+			expr: "0 9-10 * * *",
+			loc:  time.UTC,
+			from: time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2025, 5, 2, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 5, 2, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "end of month",
+			expr: "0 0 31 * *",
+			loc:  time.UTC,
+			from: time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, 5, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "across the year",
+			expr: "@monthly",
+			loc:  time.UTC,
+			from: time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "month names",
+			expr: "0 12 1 jan,jul *",
+			loc:  time.UTC,
+			from: time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC),
+			want: []time.Time{time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			loc:  time.UTC,
+			from: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			// the 13th or any Friday: Fri 2025-06-06, Fri 06-13 (both), Fri 06-20
+			name: "day of month or day of week",
+			expr: "0 0 13 * fri",
+			loc:  time.UTC,
+			from: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, 6, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "day of month with any day of week",
+			expr: "0 0 13 * *",
+			loc:  time.UTC,
+			from: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{time.Date(2025, 6, 13, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "day of week with a stepped day of month",
+			expr: "0 0 */1 * sun",
+			loc:  time.UTC,
+			from: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			loc:  time.UTC,
+			from: time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name: "evaluated in the schedule's timezone",
+			expr: "0 9 * * *",
+			loc:  berlin,
+			from: time.Date(2025, 1, 10, 7, 30, 0, 0, time.UTC),
+			want: []time.Time{time.Date(2025, 1, 10, 9, 0, 0, 0, berlin)},
+		},
+		{
+			name: "DST gap runs once when the gap ends",
+			expr: "30 2 * * *",
+			loc:  berlin,
+			from: time.Date(2025, 3, 29, 3, 0, 0, 0, berlin),
+			want: []time.Time{
+				time.Date(2025, 3, 30, 3, 0, 0, 0, berlin),
+				time.Date(2025, 3, 31, 2, 30, 0, 0, berlin),
+			},
+		},
+		{
+			name: "hourly over a DST gap",
+			expr: "0 * * * *",
+			loc:  berlin,
+			from: time.Date(2025, 3, 30, 1, 30, 0, 0, berlin),
+			want: []time.Time{
+				time.Date(2025, 3, 30, 3, 0, 0, 0, berlin),
+				time.Date(2025, 3, 30, 4, 0, 0, 0, berlin),
+			},
+		},
+		{
+			name: "DST gap outside the hour field",
+			expr: "0 5 * * *",
+			loc:  newYork,
+			from: time.Date(2025, 3, 8, 6, 0, 0, 0, newYork),
+			want: []time.Time{time.Date(2025, 3, 9, 5, 0, 0, 0, newYork)},
+		},
+		{
+			name: "daily run in a repeated hour happens once",
+			expr: "30 1 * * *",
+			loc:  newYork,
+			from: time.Date(2025, 11, 1, 12, 0, 0, 0, newYork),
+			want: []time.Time{
+				time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC),
+				time.Date(2025, 11, 3, 6, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "repeated hour runs at the first occurrence",
+			expr: "30 2 * * *",
+			loc:  berlin,
+			from: time.Date(2025, 10, 25, 3, 0, 0, 0, berlin),
+			want: []time.Time{
+				time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC), // 02:30 CEST
+				time.Date(2025, 10, 27, 1, 30, 0, 0, time.UTC), // 02:30 CET
+			},
+		},
+		{
+			name: "every half hour through a repeated hour",
+			expr: "*/30 * * * *",
+			loc:  newYork,
+			from: time.Date(2025, 11, 2, 5, 15, 0, 0, time.UTC), // 01:15 EDT
+			want: []time.Time{
+				time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2025, 11, 2, 6, 0, 0, 0, time.UTC),  // 01:00 EST
+				time.Date(2025, 11, 2, 6, 30, 0, 0, time.UTC), // 01:30 EST
+				time.Date(2025, 11, 2, 7, 0, 0, 0, time.UTC),  // 02:00 EST
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr, tt.loc)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			next := tt.from
+			for i, want := range tt.want {
+				next = c.Next(next)
+				if !next.Equal(want) {
+					t.Fatalf("activation %d after %s = %s, want %s", i+1, tt.from, next, want.In(tt.loc))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+// Group runs several named schedulers concurrently.
+type Group struct {
+	names      []string
+	schedulers map[string]*Scheduler
+}
+
+func NewGroup() *Group {
+	return &Group{schedulers: make(map[string]*Scheduler)}
+}
+
+func (g *Group) Add(name string, s *Scheduler) {
+	g.names = append(g.names, name)
+	g.schedulers[name] = s
+}
+
+func (g *Group) Names() []string {
+	return g.names
+}
+
+// States returns the scheduling state of every scheduler by name.
+func (g *Group) States() map[string]model.JobState {
+	states := make(map[string]model.JobState, len(g.names))
+	for _, n := range g.names {
+		states[n] = g.schedulers[n].State()
+	}
+	return states
+}
+
+var ErrUnknownJob = errors.New("unknown job")
+
+// Trigger requests an immediate run of the named scheduler, or of all of
+// them if name is empty. It returns the names whose run was queued; the
+// error lists the schedulers that rejected the trigger.
+func (g *Group) Trigger(name string) ([]string, error) {
+	names := g.names
+	if name != "" {
+		if _, ok := g.schedulers[name]; !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownJob, name)
+		}
+		names = []string{name}
+	}
+
+	var (
+		queued []string
+		errs   []error
+	)
+	for _, n := range names {
+		if err := g.schedulers[n].Trigger(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n, err))
+			continue
+		}
+		queued = append(queued, n)
+	}
+	return queued, errors.Join(errs...)
+}
+
+// Stop stops all schedulers; Run returns once running tasks have finished.
+func (g *Group) Stop() {
+	for _, n := range g.names {
+		g.schedulers[n].Stop()
+	}
+}
+
+// Run starts all schedulers and waits until they stop.
+func (g *Group) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, n := range g.names {
+		wg.Add(1)
+		go func(s *Scheduler) {
+			defer wg.Done()
+			s.Run(ctx)
+		}(g.schedulers[n])
+	}
+	wg.Wait()
+}
@@ -2,54 +2,303 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
 	"time"
 
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
 	"go.uber.org/zap"
 )
 
 type TaskFunc func(ctx context.Context) error
 
+// Overlap is what happens when a run is due while the previous one is
+// still in progress.
+type Overlap string
+
+const (
+	// OverlapSkip drops the activation.
+	OverlapSkip Overlap = "skip"
+	// OverlapQueue runs once more right after the current run; further
+	// activations are dropped.
+	OverlapQueue Overlap = "queue"
+	// OverlapCancel cancels the current run and starts a new one.
+	OverlapCancel Overlap = "cancel"
+)
+
+// ErrOverlapCancelled is the cause of the context of a run cancelled by the
+// OverlapCancel policy.
+var ErrOverlapCancelled = errors.New("cancelled for a newer run")
+
+func ParseOverlap(s string) (Overlap, error) {
+	switch o := Overlap(s); o {
+	case "":
+		return OverlapSkip, nil
+	case OverlapSkip, OverlapQueue, OverlapCancel:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown overlap policy %q", s)
+}
+
+// StateStore persists run times so that a restart resumes the schedule.
+type StateStore interface {
+	ScheduleState(job string) (last, next time.Time, ok bool, err error)
+	SaveScheduleState(job string, last, next time.Time) error
+}
+
+// Options tune a Scheduler. Store and Name are optional; without them the
+// schedule starts from scratch on every restart.
+type Options struct {
+	// RunOnStart runs the task right away unless the persisted state says
+	// the next run is still ahead.
+	RunOnStart bool
+	Overlap    Overlap
+	Jitter     time.Duration
+	Name       string
+	Store      StateStore
+}
+
 type Scheduler struct {
-	interval time.Duration
+	schedule Schedule
 	task     TaskFunc
+	opts     Options
+	trigger  chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
 	log      *zap.SugaredLogger
+
+	mu    sync.Mutex
+	state model.JobState
 }
 
-func New(interval time.Duration, task TaskFunc, log *zap.SugaredLogger) *Scheduler {
+// New creates a scheduler running task on schedule.
+func New(schedule Schedule, task TaskFunc, opts Options, log *zap.SugaredLogger) *Scheduler {
+	if opts.Overlap == "" {
+		opts.Overlap = OverlapSkip
+	}
 	return &Scheduler{
-		interval: interval,
+		schedule: schedule,
 		task:     task,
+		opts:     opts,
+		trigger:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
 		log:      log,
 	}
 }
 
-// type SchedulerConfig struct {
-// 	Enabled  bool   `yaml:"enabled"`
-// 	Interval string `yaml:"interval"`
-// }
+var (
+	ErrRunning   = errors.New("a scan is already running")
+	ErrTriggered = errors.New("a triggered scan is already pending")
+)
+
+// Trigger requests a single run outside of the regular schedule; the next
+// scheduled activation is not moved. It is rejected while a run is in
+// progress or another trigger is pending.
+func (s *Scheduler) Trigger() error {
+	if s.State().Running {
+		return ErrRunning
+	}
+	select {
+	case s.trigger <- struct{}{}:
+		return nil
+	default:
+		return ErrTriggered
+	}
+}
+
+// Stop makes Run return without starting new runs. A run in progress is
+// not cancelled: Run returns once it has finished.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// State returns the current scheduling state.
+func (s *Scheduler) State() model.JobState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
 
 func (s *Scheduler) Run(ctx context.Context) {
-	s.log.Infof("Running first scan...")
-	if err := s.task(ctx); err != nil {
-		s.log.Errorf("Task failed: %v", err)
+	next, runNow := s.resume(time.Now())
+
+	var (
+		done      = make(chan struct{}, 1)
+		running   bool
+		cancelRun context.CancelCauseFunc
+		pending   bool
+	)
+
+	start := func(kind string) {
+		runCtx, cancel := context.WithCancelCause(ctx)
+		cancelRun = cancel
+		running = true
+
+		startedAt := time.Now()
+		s.mu.Lock()
+		s.state.Running = true
+		s.state.LastStart = startedAt
+		s.mu.Unlock()
+		s.save(startedAt, next)
+
+		s.log.Infof("Running %s scan...", kind)
+		go func() {
+			defer cancel(nil)
+			if err := s.task(runCtx); err != nil {
+				s.log.Errorf("Task failed: %v", err)
+			}
+			s.log.Infof("Scan finished in %s", time.Since(startedAt).Round(time.Second))
+			done <- struct{}{}
+		}()
 	}
 
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
+	// due applies the overlap policy to an activation.
+	due := func(kind string) {
+		if !running {
+			start(kind)
+			return
+		}
 
-	s.log.Infof("Next scan in %s", s.interval)
+		s.mu.Lock()
+		s.state.Overruns++
+		lastStart := s.state.LastStart
+		s.mu.Unlock()
+
+		switch s.opts.Overlap {
+		case OverlapQueue:
+			if pending {
+				s.log.Warnf("Scan overrun: running for %s, a run is already queued, skipping %s scan",
+					time.Since(lastStart).Round(time.Second), kind)
+				return
+			}
+			s.log.Warnf("Scan overrun: running for %s, queueing %s scan",
+				time.Since(lastStart).Round(time.Second), kind)
+			pending = true
+		case OverlapCancel:
+			s.log.Warnf("Scan overrun: running for %s, cancelling it for %s scan",
+				time.Since(lastStart).Round(time.Second), kind)
+			cancelRun(ErrOverlapCancelled)
+			pending = true
+		default:
+			s.log.Warnf("Scan overrun: running for %s, skipping %s scan",
+				time.Since(lastStart).Round(time.Second), kind)
+		}
+	}
+
+	if runNow {
+		start("first")
+	}
+
+	timer := time.NewTimer(s.delay(next))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
+			if running {
+				<-done
+				s.mu.Lock()
+				s.state.Running = false
+				s.mu.Unlock()
+			}
 			s.log.Info("Scheduler stopped")
 			return
-		case <-ticker.C:
-			s.log.Info("Running scheduled scan...")
-			if err := s.task(ctx); err != nil {
-				s.log.Errorf("Task failed: %v", err)
+		case <-s.stop:
+			if running {
+				s.log.Info("Waiting for the running scan to finish...")
+				<-done
+				s.mu.Lock()
+				s.state.Running = false
+				s.mu.Unlock()
+			}
+			s.log.Info("Scheduler stopped")
+			return
+		case <-done:
+			running = false
+			s.mu.Lock()
+			s.state.Running = false
+			s.mu.Unlock()
+
+			if pending {
+				pending = false
+				start("queued")
+			}
+		case <-timer.C:
+			due("scheduled")
+
+			// keep the cadence, but skip activations missed by a long run
+			next = s.schedule.Next(next)
+			if now := time.Now(); next.Before(now) {
+				next = s.schedule.Next(now)
+			}
+			s.setNext(next)
+			timer.Reset(s.delay(next))
+		case <-s.trigger:
+			if running {
+				s.log.Warn("Triggered scan rejected: a scan is already running")
+				continue
+			}
+			start("triggered")
+		}
+	}
+}
+
+// resume picks the first activation, taking the persisted state into
+// account, and reports whether the task should run right away.
+func (s *Scheduler) resume(now time.Time) (time.Time, bool) {
+	next := s.schedule.Next(now)
+	runNow := s.opts.RunOnStart
+
+	if s.opts.Store != nil && s.opts.Name != "" {
+		last, saved, ok, err := s.opts.Store.ScheduleState(s.opts.Name)
+		if err != nil {
+			s.log.Errorf("Load schedule state failed: %v", err)
+		} else if ok && saved.After(now) {
+			// the previous process already ran it; a shorter schedule still wins
+			if saved.Before(next) {
+				next = saved
+			}
+			runNow = false
+			s.mu.Lock()
+			s.state.LastStart = last
+			s.mu.Unlock()
+			if !last.IsZero() {
+				s.log.Infof("Resuming schedule, last run at %s", last.Format(time.DateTime))
 			}
-			s.log.Infof("Next scan in %s", s.interval)
 		}
 	}
-}
\ No newline at end of file
+
+	s.setNext(next)
+	return next, runNow
+}
+
+// delay returns the time until next plus a random jitter.
+func (s *Scheduler) delay(next time.Time) time.Duration {
+	d := time.Until(next)
+	if s.opts.Jitter > 0 {
+		d += rand.N(s.opts.Jitter)
+	}
+	return d
+}
+
+func (s *Scheduler) setNext(next time.Time) {
+	s.mu.Lock()
+	s.state.Next = next
+	last := s.state.LastStart
+	s.mu.Unlock()
+
+	s.log.Infof("Next scan at %s (in %s)",
+		next.Format(time.DateTime), time.Until(next).Round(time.Second))
+	s.save(last, next)
+}
+
+func (s *Scheduler) save(last, next time.Time) {
+	if s.opts.Store == nil || s.opts.Name == "" {
+		return
+	}
+	if err := s.opts.Store.SaveScheduleState(s.opts.Name, last, next); err != nil {
+		s.log.Errorf("Save schedule state failed: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Qwental/port-scanner-alert-system/internal/model"
@@ -25,6 +26,10 @@ func NewStorage(dbPath string, log *zap.SugaredLogger) (*Storage, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	// jobs run concurrently; a single connection serializes writes
+	// instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+
 	s := &Storage{db: db, log: log}
 	if err := s.migrate(); err != nil {
 		return nil, err
@@ -34,7 +39,7 @@ func NewStorage(dbPath string, log *zap.SugaredLogger) (*Storage, error) {
 }
 
 func (s *Storage) migrate() error {
-	query := `
+	queries := []string{`
 	CREATE TABLE IF NOT EXISTS scan_results (
 		ip         TEXT    NOT NULL,
 		port       INTEGER NOT NULL,
@@ -43,11 +48,112 @@ func (s *Storage) migrate() error {
 		first_seen DATETIME NOT NULL,
 		last_seen  DATETIME NOT NULL,
 		PRIMARY KEY (ip, port, proto)
-	);`
+	);`, `
+	CREATE TABLE IF NOT EXISTS alerts (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		summary    TEXT    NOT NULL DEFAULT '',
+		acked_by   TEXT    NOT NULL DEFAULT '',
+		acked_at   DATETIME
+	);`, `
+	CREATE TABLE IF NOT EXISTS outbox (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel      TEXT     NOT NULL,
+		payload      BLOB     NOT NULL,
+		status       TEXT     NOT NULL DEFAULT 'pending',
+		attempts     INTEGER  NOT NULL DEFAULT 0,
+		next_attempt DATETIME NOT NULL,
+		last_error   TEXT     NOT NULL DEFAULT '',
+		reported     INTEGER  NOT NULL DEFAULT 0,
+		created_at   DATETIME NOT NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS pending_changes (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel    TEXT     NOT NULL,
+		change     TEXT     NOT NULL,
+		ip         TEXT     NOT NULL,
+		port       INTEGER  NOT NULL,
+		proto      TEXT     NOT NULL,
+		banner     TEXT     NOT NULL DEFAULT '',
+		first_seen DATETIME,
+		last_seen  DATETIME,
+		queued_at  DATETIME NOT NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS runs (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at  DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL,
+		results     INTEGER  NOT NULL DEFAULT 0,
+		new         INTEGER  NOT NULL DEFAULT 0,
+		changed     INTEGER  NOT NULL DEFAULT 0,
+		closed      INTEGER  NOT NULL DEFAULT 0,
+		error       TEXT     NOT NULL DEFAULT ''
+	);`, `
+	CREATE TABLE IF NOT EXISTS delivery_state (
+		channel    TEXT PRIMARY KEY,
+		last_flush DATETIME NOT NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS schedule_state (
+		job      TEXT PRIMARY KEY,
+		last_run DATETIME NOT NULL,
+		next_run DATETIME NOT NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS host_addrs (
+		host       TEXT PRIMARY KEY,
+		addrs      TEXT     NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`,
+	}
+
+	for _, query := range queries {
+		if _, err := s.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+	}
+
+	columns := []struct{ table, column, def string }{
+		{"runs", "job", "TEXT NOT NULL DEFAULT 'default'"},
+		{"runs", "ports", "TEXT NOT NULL DEFAULT ''"},
+		{"runs", "suspicious", "INTEGER NOT NULL DEFAULT 0"},
+		{"scan_results", "hostname", "TEXT NOT NULL DEFAULT ''"},
+		{"pending_changes", "hostname", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if err := s.addColumn(c.table, c.column, c.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	_, err := s.db.Exec(query)
+// addColumn adds a column to a table created by an older version.
+func (s *Storage) addColumn(table, column, def string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
+		return fmt.Errorf("failed to read %s schema: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return fmt.Errorf("failed to read %s schema: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s schema: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def)); err != nil {
+		return fmt.Errorf("failed to add %s.%s: %w", table, column, err)
 	}
 	return nil
 }
@@ -68,10 +174,14 @@ func (s *Storage) Upsert(results []model.ScanResult) error {
 	}()
 
 	query := `
-	INSERT INTO scan_results (ip, port, proto, banner, first_seen, last_seen)
-	VALUES (?, ?, ?, ?, ?, ?)
+	INSERT INTO scan_results (ip, port, proto, banner, first_seen, last_seen, hostname)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(ip, port, proto) DO UPDATE SET
 		last_seen = excluded.last_seen,
+		hostname = CASE
+			WHEN excluded.hostname != '' THEN excluded.hostname
+			ELSE scan_results.hostname
+		END,
 		banner = CASE 
 			WHEN excluded.banner != '' THEN excluded.banner 
 			ELSE scan_results.banner 
@@ -94,9 +204,10 @@ func (s *Storage) Upsert(results []model.ScanResult) error {
 			res.Banner,
 			now,
 			now,
+			res.Hostname,
 		)
 		if execErr != nil {
-			s.log.Errorf("Failed to upsert %s:%d/%s: %v", res.IP, res.Port, res.Proto, execErr)
+			s.log.Errorf("Failed to upsert %s: %v", res.Key(), execErr)
 			continue
 		}
 		saved++
@@ -111,8 +222,44 @@ func (s *Storage) Upsert(results []model.ScanResult) error {
 	return nil
 }
 
+// Delete removes results the diff reported as closed, so that they are
+// neither reported again nor counted as open.
+func (s *Storage) Delete(results []model.ScanResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				s.log.Errorf("Rollback failed: %v", rbErr)
+			}
+		}
+	}()
+
+	stmt, err := tx.Prepare(`DELETE FROM scan_results WHERE ip = ? AND port = ? AND proto = ?`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, res := range results {
+		if _, err := stmt.Exec(res.IP, res.Port, res.Proto); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", res.Key(), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
 func (s *Storage) GetAll() (map[string]model.ScanResult, error) {
-	query := `SELECT ip, port, proto, banner, first_seen, last_seen FROM scan_results`
+	query := `SELECT ip, port, proto, banner, first_seen, last_seen, hostname FROM scan_results`
 
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -131,6 +278,7 @@ func (s *Storage) GetAll() (map[string]model.ScanResult, error) {
 			&r.Banner,
 			&r.FirstSeen,
 			&r.LastSeen,
+			&r.Hostname,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
@@ -145,6 +293,414 @@ func (s *Storage) GetAll() (map[string]model.ScanResult, error) {
 	return results, nil
 }
 
+func (s *Storage) GetByIP(ip string) ([]model.ScanResult, error) {
+	query := `SELECT ip, port, proto, banner, first_seen, last_seen, hostname
+	FROM scan_results WHERE ip = ? ORDER BY port, proto`
+
+	rows, err := s.db.Query(query, ip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan_results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []model.ScanResult
+
+	for rows.Next() {
+		var r model.ScanResult
+		err := rows.Scan(
+			&r.IP,
+			&r.Port,
+			&r.Proto,
+			&r.Banner,
+			&r.FirstSeen,
+			&r.LastSeen,
+			&r.Hostname,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return results, nil
+}
+
+// SaveAlert records a sent alert and returns its id for acknowledgement.
+func (s *Storage) SaveAlert(summary string) (int64, error) {
+	res, err := s.db.Exec(
+		`INSERT INTO alerts (created_at, summary) VALUES (?, ?)`,
+		time.Now(), summary,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert alert: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get alert id: %w", err)
+	}
+	return id, nil
+}
+
+// AckAlert marks the alert as acknowledged. It returns false if the alert
+// does not exist or was already acknowledged.
+func (s *Storage) AckAlert(id int64, by string) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE alerts SET acked_by = ?, acked_at = ? WHERE id = ? AND acked_at IS NULL`,
+		by, time.Now(), id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to ack alert %d: %w", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to ack alert %d: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+const (
+	outboxPending = "pending"
+	outboxSent    = "sent"
+	outboxFailed  = "failed"
+)
+
+func (s *Storage) EnqueueOutbox(channel string, payload []byte) (int64, error) {
+	now := time.Now()
+	res, err := s.db.Exec(
+		`INSERT INTO outbox (channel, payload, status, next_attempt, created_at) VALUES (?, ?, ?, ?, ?)`,
+		channel, payload, outboxPending, now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert outbox entry: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get outbox id: %w", err)
+	}
+	return id, nil
+}
+
+// DueOutbox returns pending deliveries whose next attempt is not after now.
+func (s *Storage) DueOutbox(now time.Time) ([]model.OutboxEntry, error) {
+	return s.queryOutbox(`SELECT id, channel, payload, attempts, next_attempt, last_error, created_at
+	FROM outbox WHERE status = ? AND next_attempt <= ? ORDER BY id`, outboxPending, now)
+}
+
+// UnreportedFailures returns permanently failed deliveries that were not
+// yet mentioned in a successful message.
+func (s *Storage) UnreportedFailures() ([]model.OutboxEntry, error) {
+	return s.queryOutbox(`SELECT id, channel, payload, attempts, next_attempt, last_error, created_at
+	FROM outbox WHERE status = ? AND reported = 0 ORDER BY id`, outboxFailed)
+}
+
+func (s *Storage) queryOutbox(query string, args ...any) ([]model.OutboxEntry, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.OutboxEntry
+
+	for rows.Next() {
+		var e model.OutboxEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.Channel,
+			&e.Payload,
+			&e.Attempts,
+			&e.NextAttempt,
+			&e.LastError,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (s *Storage) MarkOutboxSent(id int64) error {
+	_, err := s.db.Exec(`UPDATE outbox SET status = ?, attempts = attempts + 1 WHERE id = ?`, outboxSent, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox %d sent: %w", id, err)
+	}
+	return nil
+}
+
+// MarkOutboxRetry records a failed attempt and schedules the next one.
+func (s *Storage) MarkOutboxRetry(id int64, next time.Time, lastErr string) error {
+	_, err := s.db.Exec(
+		`UPDATE outbox SET attempts = attempts + 1, next_attempt = ?, last_error = ? WHERE id = ?`,
+		next, lastErr, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule outbox %d: %w", id, err)
+	}
+	return nil
+}
+
+// UpdateOutboxPayload replaces the payload of an entry, e.g. to record the
+// parts of a message that were already delivered.
+func (s *Storage) UpdateOutboxPayload(id int64, payload []byte) error {
+	if _, err := s.db.Exec(`UPDATE outbox SET payload = ? WHERE id = ?`, payload, id); err != nil {
+		return fmt.Errorf("failed to update outbox %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Storage) MarkOutboxFailed(id int64, lastErr string) error {
+	_, err := s.db.Exec(
+		`UPDATE outbox SET status = ?, attempts = attempts + 1, last_error = ? WHERE id = ?`,
+		outboxFailed, lastErr, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox %d failed: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Storage) MarkFailuresReported(ids []int64) error {
+	for _, id := range ids {
+		if _, err := s.db.Exec(`UPDATE outbox SET reported = 1 WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to mark outbox %d reported: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// QueueChanges stores changes held back by a delivery policy.
+func (s *Storage) QueueChanges(changes []model.QueuedChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO pending_changes
+	(channel, change, ip, port, proto, banner, first_seen, last_seen, queued_at, hostname)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, c := range changes {
+		_, err := stmt.Exec(c.Channel, c.Change, c.Result.IP, c.Result.Port, c.Result.Proto,
+			c.Result.Banner, c.Result.FirstSeen, c.Result.LastSeen, now, c.Result.Hostname)
+		if err != nil {
+			return fmt.Errorf("failed to queue %s: %w", c.Result.Key(), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// PendingChanges returns queued changes of the channel in queue order.
+func (s *Storage) PendingChanges(channel string) ([]model.QueuedChange, error) {
+	rows, err := s.db.Query(`SELECT id, channel, change, ip, port, proto, banner, first_seen, last_seen, queued_at, hostname
+	FROM pending_changes WHERE channel = ? ORDER BY id`, channel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending_changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []model.QueuedChange
+
+	for rows.Next() {
+		var (
+			c         model.QueuedChange
+			firstSeen sql.NullTime
+			lastSeen  sql.NullTime
+		)
+		err := rows.Scan(
+			&c.ID,
+			&c.Channel,
+			&c.Change,
+			&c.Result.IP,
+			&c.Result.Port,
+			&c.Result.Proto,
+			&c.Result.Banner,
+			&firstSeen,
+			&lastSeen,
+			&c.QueuedAt,
+			&c.Result.Hostname,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		c.Result.FirstSeen, c.Result.LastSeen = firstSeen.Time, lastSeen.Time
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return changes, nil
+}
+
+// DeletePendingChanges removes queued changes of the channel up to and including maxID.
+func (s *Storage) DeletePendingChanges(channel string, maxID int64) error {
+	_, err := s.db.Exec(`DELETE FROM pending_changes WHERE channel = ? AND id <= ?`, channel, maxID)
+	if err != nil {
+		return fmt.Errorf("failed to delete pending changes: %w", err)
+	}
+	return nil
+}
+
+// LastFlush returns when queued changes of the channel were last sent (zero if never).
+// HasPendingChanges reports whether changes are queued for channel.
+func (s *Storage) HasPendingChanges(channel string) (bool, error) {
+	var ok bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pending_changes WHERE channel = ?)`, channel).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("failed to query pending_changes: %w", err)
+	}
+	return ok, nil
+}
+
+func (s *Storage) LastFlush(channel string) (time.Time, error) {
+	var t time.Time
+	err := s.db.QueryRow(`SELECT last_flush FROM delivery_state WHERE channel = ?`, channel).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query delivery_state: %w", err)
+	}
+	return t, nil
+}
+
+func (s *Storage) SetLastFlush(channel string, t time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO delivery_state (channel, last_flush) VALUES (?, ?)
+	ON CONFLICT(channel) DO UPDATE SET last_flush = excluded.last_flush`, channel, t)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery_state: %w", err)
+	}
+	return nil
+}
+
+// ScheduleState returns the persisted last and next run times of a job.
+// The bool is false if the job has no saved state.
+func (s *Storage) ScheduleState(job string) (last, next time.Time, ok bool, err error) {
+	err = s.db.QueryRow(`SELECT last_run, next_run FROM schedule_state WHERE job = ?`, job).Scan(&last, &next)
+	if err == sql.ErrNoRows {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("failed to query schedule_state: %w", err)
+	}
+	return last, next, true, nil
+}
+
+func (s *Storage) SaveScheduleState(job string, last, next time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO schedule_state (job, last_run, next_run) VALUES (?, ?, ?)
+	ON CONFLICT(job) DO UPDATE SET last_run = excluded.last_run, next_run = excluded.next_run`, job, last, next)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule_state: %w", err)
+	}
+	return nil
+}
+
+// HostAddrs returns the addresses a target hostname resolved to last time.
+func (s *Storage) HostAddrs(host string) ([]string, bool, error) {
+	var addrs string
+	err := s.db.QueryRow(`SELECT addrs FROM host_addrs WHERE host = ?`, host).Scan(&addrs)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query host_addrs: %w", err)
+	}
+	if addrs == "" {
+		return nil, true, nil
+	}
+	return strings.Split(addrs, ","), true, nil
+}
+
+func (s *Storage) SaveHostAddrs(host string, addrs []string) error {
+	_, err := s.db.Exec(`INSERT INTO host_addrs (host, addrs, updated_at) VALUES (?, ?, ?)
+	ON CONFLICT(host) DO UPDATE SET addrs = excluded.addrs, updated_at = excluded.updated_at`,
+		host, strings.Join(addrs, ","), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update host_addrs: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) SaveRun(run model.RunSummary) error {
+	_, err := s.db.Exec(`INSERT INTO runs (job, started_at, finished_at, results, new, changed, closed, error, ports, suspicious)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.Job, run.StartedAt, run.FinishedAt, run.Results, run.New, run.Changed, run.Closed, run.Err, run.Ports, run.Suspicious)
+	if err != nil {
+		return fmt.Errorf("failed to insert run: %w", err)
+	}
+	return nil
+}
+
+// LastRun returns the latest run of the job (of any job if job is empty),
+// successful and trusted ones only if okOnly is set. The bool is false if
+// there is no such run.
+func (s *Storage) LastRun(job string, okOnly bool) (model.RunSummary, bool, error) {
+	query := `SELECT job, started_at, finished_at, results, new, changed, closed, error, ports, suspicious FROM runs
+	WHERE (? = '' OR job = ?)`
+	if okOnly {
+		query += ` AND error = '' AND suspicious = 0`
+	}
+	query += ` ORDER BY id DESC LIMIT 1`
+
+	var r model.RunSummary
+	err := s.db.QueryRow(query, job, job).Scan(
+		&r.Job,
+		&r.StartedAt,
+		&r.FinishedAt,
+		&r.Results,
+		&r.New,
+		&r.Changed,
+		&r.Closed,
+		&r.Err,
+		&r.Ports,
+		&r.Suspicious,
+	)
+	if err == sql.ErrNoRows {
+		return r, false, nil
+	}
+	if err != nil {
+		return r, false, fmt.Errorf("failed to query runs: %w", err)
+	}
+	return r, true, nil
+}
+
+// ConsecutiveFailures counts failed runs of the job since its last successful one.
+func (s *Storage) ConsecutiveFailures(job string) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM runs
+	WHERE job = ? AND error != ''
+	AND id > COALESCE((SELECT MAX(id) FROM runs WHERE job = ? AND error = ''), 0)`, job, job).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count failed runs: %w", err)
+	}
+	return n, nil
+}
+
 func (s *Storage) Close() {
 	if s.db != nil {
 		if err := s.db.Close(); err != nil {
@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := NewStorage(filepath.Join(t.TempDir(), "scanner.db"), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestDeleteClosed(t *testing.T) {
+	s := newTestStorage(t)
+
+	results := []model.ScanResult{
+		{IP: "10.0.0.1", Port: 22, Proto: "tcp"},
+		{IP: "10.0.0.1", Port: 53, Proto: "udp"},
+		{IP: "10.0.0.1", Port: 53, Proto: "tcp"},
+		{IP: "10.0.0.2", Port: 22, Proto: "tcp"},
+	}
+	if err := s.Upsert(results); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Delete([]model.ScanResult{results[1], {IP: "10.0.0.9", Port: 80, Proto: "tcp"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("GetAll returned %d results after delete, want 3", len(all))
+	}
+	if _, ok := all[results[1].Key()]; ok {
+		t.Errorf("%s is still stored", results[1].Key())
+	}
+	if _, ok := all[results[2].Key()]; !ok {
+		t.Errorf("%s was deleted with the udp port", results[2].Key())
+	}
+
+	host, err := s.GetByIP("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(host) != 2 {
+		t.Errorf("GetByIP returned %v, want 2 open ports", host)
+	}
+}
@@ -0,0 +1,302 @@
+package target
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// List is a parsed target or exclusion list. Prefixes are deduplicated and
+// sorted, without prefixes covered by others; Hosts are hostnames to resolve
+// before each scan.
+type List struct {
+	Prefixes []netip.Prefix
+	Hosts    []string
+}
+
+// Overlap is an entry that is already covered, fully or in part, by an
+// earlier one.
+type Overlap struct {
+	Entry  string
+	Covers string
+}
+
+func (o Overlap) String() string {
+	if o.Entry == o.Covers {
+		return fmt.Sprintf("%s is listed twice", o.Entry)
+	}
+	return fmt.Sprintf("%s overlaps %s", o.Entry, o.Covers)
+}
+
+// ParseEntry is Parse that also accepts a hostname, returned as host with
+// no prefixes.
+func ParseEntry(s string) (prefixes []netip.Prefix, host string, err error) {
+	s = strings.TrimSpace(s)
+	prefixes, err = Parse(s)
+	if err == nil {
+		return prefixes, "", nil
+	}
+	if IsHostname(s) {
+		return nil, strings.ToLower(strings.TrimSuffix(s, ".")), nil
+	}
+	if !strings.Contains(s, ":") && strings.ContainsFunc(s, unicode.IsLetter) {
+		return nil, "", fmt.Errorf("invalid target %q: not an IP, CIDR, range or hostname", s)
+	}
+	return nil, "", err
+}
+
+// IsHostname reports whether s is a valid DNS name that is not an address.
+func IsHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	if _, err := netip.ParseAddr(s); err == nil {
+		return false
+	}
+
+	labels := strings.Split(s, ".")
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+		for _, c := range l {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+	// an all-numeric last label is a malformed address, not a name
+	return strings.TrimLeft(labels[len(labels)-1], "0123456789") != ""
+}
+
+// ParseList parses entries into a List and reports the entries that repeat
+// or overlap earlier ones.
+func ParseList(entries []string) (List, []Overlap, error) {
+	var (
+		l        List
+		overlaps []Overlap
+		owners   []string // entry of each prefix in l.Prefixes
+		hosts    = make(map[string]string)
+	)
+
+	for _, e := range entries {
+		prefixes, host, err := ParseEntry(e)
+		if err != nil {
+			return List{}, nil, err
+		}
+		e = strings.TrimSpace(e)
+
+		if host != "" {
+			if prev, ok := hosts[host]; ok {
+				overlaps = append(overlaps, Overlap{Entry: e, Covers: prev})
+				continue
+			}
+			hosts[host] = e
+			l.Hosts = append(l.Hosts, host)
+			continue
+		}
+
+		// report each entry once, naming an identical one if there is
+		covers := -1
+		for _, p := range prefixes {
+			for i, q := range l.Prefixes {
+				if p == q {
+					covers = i
+					break
+				}
+				if covers < 0 && p.Overlaps(q) {
+					covers = i
+				}
+			}
+		}
+		if covers >= 0 {
+			overlaps = append(overlaps, Overlap{Entry: e, Covers: owners[covers]})
+		}
+		for _, p := range prefixes {
+			l.Prefixes = append(l.Prefixes, p)
+			owners = append(owners, e)
+		}
+	}
+
+	l.Prefixes = merge(l.Prefixes)
+	return l, overlaps, nil
+}
+
+// merge sorts prefixes and drops those covered by another one.
+func merge(prefixes []netip.Prefix) []netip.Prefix {
+	slices.SortFunc(prefixes, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+
+	out := prefixes[:0]
+	for _, p := range prefixes {
+		if n := len(out); n > 0 && out[n-1].Overlaps(p) {
+			// sorted by address then size, so the earlier one is the wider
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// With returns l with prefixes added.
+func (l List) With(prefixes []netip.Prefix) List {
+	return List{Prefixes: merge(slices.Concat(l.Prefixes, prefixes)), Hosts: l.Hosts}
+}
+
+// Strings returns the list in masscan target syntax, hostnames last.
+// Adjacent prefixes are joined into one CIDR or "first-last" range.
+func (l List) Strings() []string {
+	out := make([]string, 0, len(l.Prefixes)+len(l.Hosts))
+	for i := 0; i < len(l.Prefixes); {
+		first, last := l.Prefixes[i].Addr(), lastAddr(l.Prefixes[i])
+		for i++; i < len(l.Prefixes) && last.Next() == l.Prefixes[i].Addr(); i++ {
+			last = lastAddr(l.Prefixes[i])
+		}
+		out = append(out, formatRange(first, last))
+	}
+	return append(out, l.Hosts...)
+}
+
+func formatRange(first, last netip.Addr) string {
+	switch prefixes := rangePrefixes(first, last); {
+	case first == last:
+		return first.String()
+	case len(prefixes) == 1:
+		return prefixes[0].String()
+	default:
+		return first.String() + "-" + last.String()
+	}
+}
+
+// Covers reports whether the addresses of target t lie entirely within the
+// prefixes of l, possibly spread over several of them.
+func (l List) Covers(t string) bool {
+	prefixes, err := Parse(t)
+	if err != nil {
+		return false
+	}
+	for _, p := range prefixes {
+		if !l.coversRange(p.Addr(), lastAddr(p)) {
+			return false
+		}
+	}
+	return true
+}
+
+// coversRange relies on l.Prefixes being sorted and disjoint.
+func (l List) coversRange(first, last netip.Addr) bool {
+	for _, q := range l.Prefixes {
+		if !q.Contains(first) {
+			continue
+		}
+		end := lastAddr(q)
+		if end.Compare(last) >= 0 {
+			return true
+		}
+		first = end.Next()
+	}
+	return false
+}
+
+// ReadFile reads a target file: one entry per line, blank lines and
+// everything after "#" ignored. Errors name the file and line.
+func ReadFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []string
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if _, _, err := ParseEntry(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		out = append(out, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return out, nil
+}
+
+// Load combines inline entries with the entries of file, if set.
+func Load(entries []string, file string) (List, []Overlap, error) {
+	if file != "" {
+		lines, err := ReadFile(file)
+		if err != nil {
+			return List{}, nil, err
+		}
+		entries = slices.Concat(entries, lines)
+	}
+	return ParseList(entries)
+}
+
+// Resolver looks up the addresses of a name; *net.Resolver is one.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// StaticResolver resolves names from a fixed table, e.g. in tests.
+type StaticResolver map[string][]netip.Addr
+
+func (s StaticResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := s[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// Resolve returns l with hostnames replaced by all their A and AAAA
+// addresses, and the sorted addresses of each name. Names that fail to
+// resolve are left out and reported in the error.
+func (l List) Resolve(ctx context.Context, r Resolver) (List, map[string][]netip.Addr, error) {
+	if len(l.Hosts) == 0 {
+		return l, nil, nil
+	}
+
+	out := List{Prefixes: slices.Clone(l.Prefixes)}
+	names := make(map[string][]netip.Addr, len(l.Hosts))
+	var errs []error
+	for _, h := range l.Hosts {
+		addrs, err := r.LookupNetIP(ctx, "ip", h)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolve %s: %w", h, err))
+			continue
+		}
+
+		var resolved []netip.Addr
+		for _, a := range addrs {
+			a = a.Unmap()
+			if !slices.Contains(resolved, a) {
+				resolved = append(resolved, a)
+			}
+			out.Prefixes = append(out.Prefixes, netip.PrefixFrom(a, a.BitLen()))
+		}
+		slices.SortFunc(resolved, netip.Addr.Compare)
+		names[h] = resolved
+	}
+	out.Prefixes = merge(out.Prefixes)
+	return out, names, errors.Join(errs...)
+}
@@ -0,0 +1,315 @@
+package target
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	out := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = p.String()
+	}
+	return out
+}
+
+func mustList(t *testing.T, entries ...string) List {
+	t.Helper()
+	l, _, err := ParseList(entries)
+	if err != nil {
+		t.Fatalf("ParseList(%q): %v", entries, err)
+	}
+	return l
+}
+
+func TestIsHostname(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"web01", true},
+		{"web01.corp", true},
+		{"Web01.Example.COM.", true},
+		{"host-1.example.com", true},
+		{"_dmarc.example.com", true},
+		{"xn--80ak6aa92e.com", true},
+		{"3com.net", true},
+		{"1.2.3.4x", true},
+		{"", false},
+		{".", false},
+		{"10.0.0.1", false},
+		{"10.0.0.256", false},
+		{"1.2.3.4.5", false},
+		{"123", false},
+		{"example.123", false},
+		{"::1", false},
+		{"-web.corp", false},
+		{"web-.corp", false},
+		{"web..corp", false},
+		{"web corp", false},
+		{"web!.corp", false},
+		{strings.Repeat("a", 64) + ".com", false},
+		{strings.Repeat("a.", 127) + "com", false},
+	}
+	for _, tt := range tests {
+		if got := IsHostname(tt.s); got != tt.want {
+			t.Errorf("IsHostname(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		s        string
+		prefixes []string
+		host     string
+		err      string
+	}{
+		{s: "10.0.0.1", prefixes: []string{"10.0.0.1/32"}},
+		{s: " 10.0.0.7/24 ", prefixes: []string{"10.0.0.0/24"}},
+		{s: "10.0.0.1-10.0.0.6", prefixes: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{s: "::ffff:10.0.0.0/120", prefixes: []string{"10.0.0.0/24"}},
+		{s: "[2001:db8::1]", prefixes: []string{"2001:db8::1/128"}},
+		{s: "2001:db8::-2001:db8::3", prefixes: []string{"2001:db8::/126"}},
+		{s: "Web01.Corp.", host: "web01.corp"},
+		{s: "10.0.0.256", err: "invalid IP"},
+		{s: "10.0.0.5-10.0.0.1", err: "invalid range"},
+		{s: "10.0.0.1-2001:db8::1", err: "invalid range"},
+		{s: "web!.corp", err: "not an IP, CIDR, range or hostname"},
+		{s: "10.0.0.0/33", err: "invalid CIDR"},
+	}
+	for _, tt := range tests {
+		prefixes, host, err := ParseEntry(tt.s)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseEntry(%q) error = %v, want %q", tt.s, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseEntry(%q): %v", tt.s, err)
+			continue
+		}
+		if got := prefixStrings(prefixes); !slices.Equal(got, tt.prefixes) || host != tt.host {
+			t.Errorf("ParseEntry(%q) = %v %q, want %v %q", tt.s, got, host, tt.prefixes, tt.host)
+		}
+	}
+}
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		first, last string
+		want        []string
+	}{
+		{"10.0.0.0", "10.0.0.0", []string{"10.0.0.0/32"}},
+		{"10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.255", "10.0.1.0", []string{"10.0.0.255/32", "10.0.1.0/32"}},
+		{"10.0.0.1", "10.0.0.254", []string{
+			"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/28", "10.0.0.32/27",
+			"10.0.0.64/26", "10.0.0.128/26", "10.0.0.192/27", "10.0.0.224/28", "10.0.0.240/29",
+			"10.0.0.248/30", "10.0.0.252/31", "10.0.0.254/32",
+		}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"2001:db8::ff", "2001:db8::100", []string{"2001:db8::ff/128", "2001:db8::100/128"}},
+	}
+	for _, tt := range tests {
+		got := prefixStrings(rangePrefixes(netip.MustParseAddr(tt.first), netip.MustParseAddr(tt.last)))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("rangePrefixes(%s, %s) = %v, want %v", tt.first, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		prefixes []string
+		hosts    []string
+		overlaps []string
+	}{
+		{
+			name:     "sorted, v4 before v6",
+			entries:  []string{"2001:db8::1", "10.0.1.0/24", "10.0.0.0/24", "192.168.0.1"},
+			prefixes: []string{"10.0.0.0/24", "10.0.1.0/24", "192.168.0.1/32", "2001:db8::1/128"},
+		},
+		{
+			name:     "nested prefixes removed",
+			entries:  []string{"10.0.0.5", "10.0.0.0/24", "10.0.0.0/16", "10.1.0.0/16"},
+			prefixes: []string{"10.0.0.0/16", "10.1.0.0/16"},
+			overlaps: []string{"10.0.0.0/24 overlaps 10.0.0.5", "10.0.0.0/16 overlaps 10.0.0.5"},
+		},
+		{
+			name:     "exact duplicate named before a wider overlap",
+			entries:  []string{"10.0.0.0/16", "10.0.0.0/24", "10.0.0.0/24"},
+			prefixes: []string{"10.0.0.0/16"},
+			overlaps: []string{"10.0.0.0/24 overlaps 10.0.0.0/16", "10.0.0.0/24 is listed twice"},
+		},
+		{
+			name:     "range overlapping in several prefixes reported once",
+			entries:  []string{"10.0.0.2", "10.0.0.5", "10.0.0.1-10.0.0.6"},
+			prefixes: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"},
+			overlaps: []string{"10.0.0.1-10.0.0.6 overlaps 10.0.0.2"},
+		},
+		{
+			name:     "same address in different notations",
+			entries:  []string{"10.0.0.1", "::ffff:10.0.0.1", "10.0.0.1/32"},
+			prefixes: []string{"10.0.0.1/32"},
+			overlaps: []string{"::ffff:10.0.0.1 overlaps 10.0.0.1", "10.0.0.1/32 overlaps 10.0.0.1"},
+		},
+		{
+			name:     "hostnames deduplicated case-insensitively",
+			entries:  []string{"web01.corp", "10.0.0.1", "WEB01.corp.", "db.corp"},
+			prefixes: []string{"10.0.0.1/32"},
+			hosts:    []string{"web01.corp", "db.corp"},
+			overlaps: []string{"WEB01.corp. overlaps web01.corp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, overlaps, err := ParseList(tt.entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := prefixStrings(l.Prefixes); !slices.Equal(got, tt.prefixes) {
+				t.Errorf("prefixes = %v, want %v", got, tt.prefixes)
+			}
+			if !slices.Equal(l.Hosts, tt.hosts) {
+				t.Errorf("hosts = %v, want %v", l.Hosts, tt.hosts)
+			}
+			var got []string
+			for _, o := range overlaps {
+				got = append(got, o.String())
+			}
+			if !slices.Equal(got, tt.overlaps) {
+				t.Errorf("overlaps = %q, want %q", got, tt.overlaps)
+			}
+		})
+	}
+
+	if _, _, err := ParseList([]string{"10.0.0.1", "bad!entry"}); err == nil {
+		t.Error("ParseList with an invalid entry succeeded")
+	}
+}
+
+func TestListStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string
+	}{
+		{"single address", []string{"10.0.0.1"}, []string{"10.0.0.1"}},
+		{"adjacent halves join into a CIDR", []string{"10.0.1.0/24", "10.0.0.0/24"}, []string{"10.0.0.0/23"}},
+		{"unaligned neighbours join into a range", []string{"10.0.0.1", "10.0.0.2/31", "10.0.0.4"}, []string{"10.0.0.1-10.0.0.4"}},
+		{"a range is kept", []string{"10.0.0.1-10.0.0.6"}, []string{"10.0.0.1-10.0.0.6"}},
+		{"gaps are kept", []string{"10.0.0.1", "10.0.0.3"}, []string{"10.0.0.1", "10.0.0.3"}},
+		{"across an octet", []string{"10.0.0.255", "10.0.1.0"}, []string{"10.0.0.255-10.0.1.0"}},
+		{"v4 end does not join v6", []string{"255.255.255.255", "::"}, []string{"255.255.255.255", "::"}},
+		{"v6 neighbours", []string{"2001:db8::/127", "2001:db8::2/127"}, []string{"2001:db8::/126"}},
+		{"hostnames last", []string{"web01.corp", "10.0.0.1"}, []string{"10.0.0.1", "web01.corp"}},
+	}
+	for _, tt := range tests {
+		if got := mustList(t, tt.entries...).Strings(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Strings() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListCovers(t *testing.T) {
+	l := mustList(t, "10.0.0.0/24", "10.0.1.0/25", "10.0.1.128/25", "10.0.3.0/24", "2001:db8::/120")
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"10.0.0.5", true},
+		{"10.0.0.0/24", true},
+		{"10.0.0.0/23", true}, // split over three prefixes
+		{"10.0.0.200-10.0.1.10", true},
+		{"10.0.0.0/22", false}, // 10.0.2.0/24 is missing
+		{"10.0.1.255-10.0.2.0", false},
+		{"10.0.3.0-10.0.3.255", true},
+		{"10.0.4.0", false},
+		{"2001:db8::10", true},
+		{"2001:db8::/119", false},
+		{"::ffff:10.0.0.1", true},
+		{"web01.corp", false},
+	}
+	for _, tt := range tests {
+		if got := l.Covers(tt.target); got != tt.want {
+			t.Errorf("Covers(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+
+	if (List{}).Covers("10.0.0.1") {
+		t.Error("empty list covers 10.0.0.1")
+	}
+}
+
+func TestListWith(t *testing.T) {
+	l := mustList(t, "10.0.0.0/24", "web01.corp")
+	got := l.With([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.5/32"),
+		netip.MustParsePrefix("10.0.1.0/24"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+	})
+	if want := []string{"10.0.0.0/23", "192.168.0.0/16", "web01.corp"}; !slices.Equal(got.Strings(), want) {
+		t.Errorf("With() = %v, want %v", got.Strings(), want)
+	}
+	if want := []string{"10.0.0.0/24", "web01.corp"}; !slices.Equal(l.Strings(), want) {
+		t.Errorf("With changed the original list to %v", l.Strings())
+	}
+}
+
+func TestListResolve(t *testing.T) {
+	r := StaticResolver{
+		"web01.corp": {netip.MustParseAddr("10.0.0.9"), netip.MustParseAddr("::ffff:10.0.0.8"), netip.MustParseAddr("10.0.0.9")},
+		"web02.corp": {netip.MustParseAddr("2001:db8::2"), netip.MustParseAddr("10.0.0.1")},
+	}
+	l := mustList(t, "10.0.0.0/30", "web01.corp", "web02.corp", "gone.corp")
+
+	resolved, names, err := l.Resolve(context.Background(), r)
+	if err == nil || !strings.Contains(err.Error(), "gone.corp") {
+		t.Errorf("Resolve error = %v, want one naming gone.corp", err)
+	}
+	if len(resolved.Hosts) != 0 {
+		t.Errorf("resolved list still has hosts %v", resolved.Hosts)
+	}
+	wantPrefixes := []string{"10.0.0.0/30", "10.0.0.8/32", "10.0.0.9/32", "2001:db8::2/128"}
+	if got := prefixStrings(resolved.Prefixes); !slices.Equal(got, wantPrefixes) {
+		t.Errorf("resolved prefixes = %v, want %v", got, wantPrefixes)
+	}
+	if got := resolved.Strings(); !slices.Equal(got, []string{"10.0.0.0/30", "10.0.0.8/31", "2001:db8::2"}) {
+		t.Errorf("resolved Strings() = %v", got)
+	}
+
+	wantNames := map[string][]string{
+		"web01.corp": {"10.0.0.8", "10.0.0.9"},
+		"web02.corp": {"10.0.0.1", "2001:db8::2"},
+	}
+	if len(names) != len(wantNames) {
+		t.Errorf("names = %v, want %v", names, wantNames)
+	}
+	for h, want := range wantNames {
+		var got []string
+		for _, a := range names[h] {
+			got = append(got, a.String())
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("names[%s] = %v, want %v", h, got, want)
+		}
+	}
+
+	if got := prefixStrings(l.Prefixes); !slices.Equal(got, []string{"10.0.0.0/30"}) {
+		t.Errorf("Resolve changed the original list to %v", got)
+	}
+
+	plain := mustList(t, "10.0.0.1")
+	if _, names, err := plain.Resolve(context.Background(), r); err != nil || names != nil {
+		t.Errorf("Resolve without hostnames = %v, %v", names, err)
+	}
+}
@@ -0,0 +1,175 @@
+package target
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/Qwental/port-scanner-alert-system/internal/model"
+	"github.com/Qwental/port-scanner-alert-system/internal/portset"
+)
+
+// ParsePrefix accepts a CIDR or a single IP address.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		return unmap(p.Masked()), nil
+	}
+
+	// [2001:db8::1] as in URLs
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP %q: %w", s, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// unmap turns an IPv4-mapped IPv6 prefix such as ::ffff:10.0.0.0/120 into
+// the IPv4 prefix it stands for.
+func unmap(p netip.Prefix) netip.Prefix {
+	if !p.Addr().Is4In6() || p.Bits() < 96 {
+		return p
+	}
+	return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+}
+
+// MinIPv6Bits is the widest IPv6 prefix accepted as a scan target. Wider
+// ranges hold more than 2^32 addresses and cannot be swept in useful time;
+// list the hosts or their hostnames instead.
+const MinIPv6Bits = 96
+
+// CheckScannable returns an error for IPv6 prefixes wider than MinIPv6Bits.
+func CheckScannable(prefixes []netip.Prefix) error {
+	for _, p := range prefixes {
+		if p.Addr().Is6() && p.Bits() < MinIPv6Bits {
+			return fmt.Errorf("IPv6 range %s is too large to scan, use /%d or narrower", p, MinIPv6Bits)
+		}
+	}
+	return nil
+}
+
+// Parse accepts masscan target syntax: an IP, a CIDR or a "first-last" range,
+// and returns the covering prefixes.
+func Parse(s string) ([]netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+
+	from, to, isRange := strings.Cut(s, "-")
+	if !isRange {
+		p, err := ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		return []netip.Prefix{p}, nil
+	}
+
+	first, err := netip.ParseAddr(strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	last, err := netip.ParseAddr(strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	first, last = first.Unmap(), last.Unmap()
+	if first.Is4() != last.Is4() || last.Less(first) {
+		return nil, fmt.Errorf("invalid range %q", s)
+	}
+
+	return rangePrefixes(first, last), nil
+}
+
+// rangePrefixes splits [first, last] into the minimal list of prefixes.
+func rangePrefixes(first, last netip.Addr) []netip.Prefix {
+	var out []netip.Prefix
+	bits := first.BitLen()
+
+	for {
+		// grow the prefix while it starts at first and stays within last
+		size := bits
+		for size > 0 {
+			p := netip.PrefixFrom(first, size-1).Masked()
+			if p.Addr() != first || lastAddr(p).Compare(last) > 0 {
+				break
+			}
+			size--
+		}
+
+		p := netip.PrefixFrom(first, size)
+		out = append(out, p)
+
+		end := lastAddr(p)
+		if end.Compare(last) >= 0 {
+			return out
+		}
+		first = end.Next()
+	}
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Scope describes which results a scan job is responsible for, so that ports
+// owned by other jobs are not reported as closed.
+type Scope struct {
+	Prefixes []netip.Prefix
+	// Exclude is never scanned, so results in it are not the job's.
+	Exclude []netip.Prefix
+	// Ports maps a protocol to its scanned ports. It is nil when the job's
+	// port lists could not be parsed; then only addresses are checked.
+	Ports map[string]portset.Set
+}
+
+// NewScope builds the scope of resolved target and exclusion lists and the
+// TCP and UDP port lists.
+func NewScope(targets, exclude List, tcp, udp string) Scope {
+	s := Scope{Prefixes: targets.Prefixes, Exclude: exclude.Prefixes}
+	tcpSet, tcpErr := portset.Parse(tcp)
+	udpSet, udpErr := portset.Parse(udp)
+	if tcpErr == nil && udpErr == nil {
+		s.Ports = map[string]portset.Set{"tcp": tcpSet, "udp": udpSet}
+	}
+	return s
+}
+
+func (s Scope) Contains(r model.ScanResult) bool {
+	addr, err := netip.ParseAddr(r.IP)
+	if err != nil {
+		return false
+	}
+	if s.Ports != nil && !s.Ports[r.Proto].Contains(r.Port) {
+		return false
+	}
+	return ContainsAddr(s.Prefixes, addr) && !ContainsAddr(s.Exclude, addr)
+}
+
+// Filter returns the part of previous that belongs to the scope.
+func (s Scope) Filter(previous map[string]model.ScanResult) map[string]model.ScanResult {
+	out := make(map[string]model.ScanResult, len(previous))
+	for k, r := range previous {
+		if s.Contains(r) {
+			out[k] = r
+		}
+	}
+	return out
+}
+
+func ContainsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}